@@ -1,18 +1,48 @@
 package addfriend
 
 import (
+	"api/auditlog"
+	"api/blockuser"
+	"api/friends"
+	"api/hasura"
 	"api/updateseen"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/clerk/clerk-sdk-go/v2/jwt"
 	"github.com/clerk/clerk-sdk-go/v2/user"
+
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+const (
+	OperationHistory           = "history"
+	OperationReadNotifications = "read_notifications"
+
+	NotificationFriendRequestReceived = "friend_request_received"
+	NotificationFriendRequestAccepted = "friend_request_accepted"
+	NotificationFriendRemoved         = "friend_removed"
+
+	MentorshipStatusPending  = "pending"
+	MentorshipStatusAccepted = "accepted"
+	MentorshipStatusDeclined = "declined"
+)
+
+var (
+	ErrBlocked           = errors.New("friend requests between these users are blocked")
+	ErrMentorshipBlocked = errors.New("mentorship requests between these users are blocked")
+
+	ErrMentorshipExists      = errors.New("mentorship already exists")
+	ErrMentorshipRequestSent = errors.New("mentorship request already sent")
+	ErrNoMentorshipRequest   = errors.New("no open mentorship request found")
+	ErrMentorshipConflict    = errors.New("mentorship was changed concurrently, please retry")
 )
 
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -40,8 +70,11 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	userID := query.Get("user_id")
 	friendEmail := query.Get("friend_email")
 	operation := query.Get("operation")
+	relationship := query.Get("relationship")
+	note := strings.TrimSpace(query.Get("note"))
+	role := query.Get("role")
 
-	if userID == "" || friendEmail == "" || operation == "" {
+	if userID == "" || operation == "" || (friendEmail == "" && operation != OperationReadNotifications) {
 		http.Error(w, "Missing user_id or friend_email query parameter", http.StatusBadRequest)
 		return
 	}
@@ -51,26 +84,111 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	updateseen.UpdateUserInHasura(userID)
+	if operation == OperationReadNotifications {
+		if err := MarkFriendNotificationsRead(userID, query.Get("notification_id")); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to mark notifications as read: %s", err), http.StatusInternalServerError)
+			log.Printf("Error marking notifications as read: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"Notifications marked as read"}`))
+		log.Printf("Friend notifications marked as read for %s", userID)
+		return
+	}
 	friendID, err := GetFriendIDByEmail(friendEmail)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to find friend by email: %s", err), http.StatusInternalServerError)
 		log.Printf("Error finding friend by email: %s", err)
 		return
 	}
-	if operation == "add" {
-		err = insertFriend(userID, friendID)
-	} else if operation == "remove" {
-		err = deleteFriend(userID, friendID)
+	if relationship == "mentorship" {
+		mentorID, menteeID := userID, friendID
+		if role == "mentee" {
+			mentorID, menteeID = friendID, userID
+		} else if role != "mentor" {
+			http.Error(w, "Invalid role, expected mentor or mentee", http.StatusBadRequest)
+			return
+		}
+		if operation == "add" {
+			err = insertMentorship(userID, mentorID, menteeID)
+		} else if operation == "decline" {
+			err = declineMentorship(userID, mentorID, menteeID)
+		} else if operation == "remove" {
+			err = deleteMentorship(mentorID, menteeID)
+		} else {
+			http.Error(w, "Invalid operation", http.StatusBadRequest)
+			return
+		}
+	} else if relationship == "" || relationship == "friend" {
+		if operation == OperationHistory {
+			events, err := GetFriendEvents(userID, friendID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get friend history: %s", err), http.StatusInternalServerError)
+				log.Printf("Error getting friend history: %s", err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(events)
+			log.Printf("Friend history successfully retrieved")
+			return
+		}
+		if operation == friends.OperationEditNote && note == "" {
+			http.Error(w, "Missing note query parameter", http.StatusBadRequest)
+			return
+		}
+		status, err := ApplyFriendOperation(userID, friendID, operation, note)
+		if errors.Is(err, friends.ErrInvalidOperation) {
+			http.Error(w, "Invalid operation", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, friends.ErrNoteTooLong) || errors.Is(err, friends.ErrSelf) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, friends.ErrFriendshipExists) || errors.Is(err, friends.ErrFriendRequestSent) || errors.Is(err, friends.ErrNoFriendRequest) || errors.Is(err, friends.ErrNotFriends) || errors.Is(err, friends.ErrFriendConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, friends.ErrDeclineCooldown) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to do friend operation:  %s", err), http.StatusInternalServerError)
+			log.Printf("Error with friend operation: %s", err)
+			return
+		}
+		auditlog.Record(r, userID, "friend."+operation, friendID, map[string]interface{}{"status": status})
+		w.WriteHeader(http.StatusCreated)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Friend operation successfully completed", "status": status})
+		log.Printf("Friend operation successfully completed with status %s", status)
+		return
 	} else {
-		http.Error(w, "Invalid operation", http.StatusBadRequest)
+		http.Error(w, "Invalid relationship", http.StatusBadRequest)
 		return
 	}
 
+	if errors.Is(err, ErrMentorshipBlocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrMentorshipExists) || errors.Is(err, ErrMentorshipRequestSent) || errors.Is(err, ErrNoMentorshipRequest) || errors.Is(err, ErrMentorshipConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to do friend operation:  %s", err), http.StatusInternalServerError)
 		log.Printf("Error with friend operation: %s", err)
 		return
 	}
+	auditlog.Record(r, userID, "mentorship."+operation, friendID, map[string]interface{}{"role": role})
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"message":"Friend operation successfully completed"}`))
@@ -90,66 +208,60 @@ func GetFriendIDByEmail(email string) (string, error) {
 			"email": email,
 		},
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request body: %w", err)
+	var responseData struct {
+		Users []struct {
+			ID string `json:"id"`
+		} `json:"users"`
 	}
-
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to get user by email: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request to Hasura: %w", err)
+	if len(responseData.Users) == 0 {
+		return "", fmt.Errorf("user with email %s not found", email)
 	}
-	defer resp.Body.Close()
+	return responseData.Users[0].ID, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+type FriendNotification struct {
+	ID        interface{} `json:"id"`
+	UserID    string      `json:"user_id"`
+	ActorID   string      `json:"actor_id"`
+	Type      string      `json:"type"`
+	CreatedAt string      `json:"created_at"`
+	ReadAt    *string     `json:"read_at"`
+}
 
-	var responseBody struct {
-		Data struct {
-			Users []struct {
-				ID string `json:"id"`
-			} `json:"users"`
-		} `json:"data"`
+func ApplyFriendOperation(userID, friendID, operation, note string) (string, error) {
+	if operation == friends.OperationRequest || operation == friends.OperationAdd || operation == friends.OperationAccept {
+		blocked, err := blockuser.IsBlocked(userID, friendID)
+		if err != nil {
+			return "", err
+		}
+		if blocked {
+			return "", ErrBlocked
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	status, err := friends.Apply(userID, friendID, operation, note)
+	if err != nil {
+		return "", err
 	}
-	if len(responseBody.Data.Users) == 0 {
-		return "", fmt.Errorf("user with email %s not found", email)
+	if operation != friends.OperationEditNote && operation != friends.OperationWithdrawNote {
+		notifyFriendOperation(friendID, userID, status)
 	}
-
-	return responseBody.Data.Users[0].ID, nil
+	return status, nil
 }
-
-func insertFriend(userID, friendID string) error {
+func GetFriendEvents(userID, friendID string) ([]map[string]interface{}, error) {
 	firstID, secondID := userID, friendID
 	if userID > friendID {
 		firstID, secondID = friendID, userID
 	}
-	if userID == friendID {
-		return fmt.Errorf("cannot add self as friend")
-	}
 	query := `
-		query CheckFriendship($first_id: String!, $second_id: String!){
-			friends(where: {
-				user_id: {_eq: $first_id},
-				friend_id: {_eq: $second_id}
-			}){
-				id
-				to_accept
-				status	
+		query GetFriendEvents($first_id: String!, $second_id: String!) {
+			friend_events(where: {user_id: {_eq: $first_id}, friend_id: {_eq: $second_id}}, order_by: {created_at: asc}) {
+				actor_id
+				from_status
+				to_status
+				created_at
 			}
 		}
 	`
@@ -160,143 +272,276 @@ func insertFriend(userID, friendID string) error {
 			"second_id": secondID,
 		},
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to create request body: %w", err)
+	var responseData struct {
+		FriendEvents []map[string]interface{} `json:"friend_events"`
 	}
-
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get friend events: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request to Hasura: %w", err)
+	return responseData.FriendEvents, nil
+}
+func NotificationType(status string) string {
+	switch status {
+	case friends.StatusRequested:
+		return NotificationFriendRequestReceived
+	case friends.StatusAccepted:
+		return NotificationFriendRequestAccepted
+	case friends.StatusRemoved:
+		return NotificationFriendRemoved
+	}
+	return ""
+}
+func notifyFriendOperation(recipientID, actorID, status string) {
+	notificationType := NotificationType(status)
+	if notificationType == "" {
+		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-	var responseBody struct {
-		Data struct {
-			Friends []struct {
-				ID       interface{} `json:"id"`
-				ToAccept string      `json:"to_accept"`
-				Status   string      `json:"status"`
-			} `json:"friends"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
-	}
-	if len(responseBody.Data.Friends) > 0 {
-		existingFriend := responseBody.Data.Friends[0]
-		if existingFriend.Status == "accepted" {
-			return fmt.Errorf("friendship already exists")
-		}
-		if existingFriend.ToAccept == friendID && existingFriend.Status == "pending" {
-			return fmt.Errorf("friend request already sent")
-		}
-		if existingFriend.ToAccept == userID && existingFriend.Status == "pending" {
-			mutation := `
-				mutation UpdateFriendStatus($id: bigint!, $status: String!) {
-					update_friends_by_pk(pk_columns: {id: $id}, _set: {status: $status}) {
-						id
-					}
-				}
-			`
-			updateRequestBody := map[string]interface{}{
-				"query": mutation,
-				"variables": map[string]interface{}{
-					"id":     existingFriend.ID,
-					"status": "accepted",
-				},
-			}
-			jsonBody, err = json.Marshal(updateRequestBody)
-			if err != nil {
-				return fmt.Errorf("failed to create update request body: %w", err)
-			}
-			req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-			if err != nil {
-				return fmt.Errorf("failed to create update request: %w", err)
-			}
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-			resp, err := client.Do(req)
-			if err != nil {
-				return fmt.Errorf("failed to send update request to Hasura: %w", err)
+	if muted, err := blockuser.IsMuted(recipientID, actorID); err != nil {
+		log.Printf("Error checking mute for %s: %s", recipientID, err)
+	} else if muted {
+		return
+	}
+	if err := NotifyFriendEvent(recipientID, actorID, notificationType); err != nil {
+		log.Printf("Error notifying %s of %s: %s", recipientID, notificationType, err)
+	}
+}
+func NotifyFriendEvent(recipientID, actorID, notificationType string) error {
+	mutation := `
+		mutation InsertFriendNotification($object: friend_notifications_insert_input!) {
+			insert_friend_notifications_one(object: $object) {
+				id
+				user_id
+				actor_id
+				type
+				created_at
+				read_at
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("unexpected status code for update: %d", resp.StatusCode)
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"user_id":    recipientID,
+				"actor_id":   actorID,
+				"type":       notificationType,
+				"created_at": time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	var responseData struct {
+		InsertFriendNotificationsOne FriendNotification `json:"insert_friend_notifications_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to insert friend notification: %w", err)
+	}
+	BroadcastFriendNotification(responseData.InsertFriendNotificationsOne)
+	return nil
+}
+func GetFriendNotifications(userID string) ([]FriendNotification, error) {
+	query := `
+		query GetFriendNotifications($userID: String!) {
+			friend_notifications(where: {user_id: {_eq: $userID}, read_at: {_is_null: true}}, order_by: {created_at: asc}) {
+				id
+				user_id
+				actor_id
+				type
+				created_at
+				read_at
 			}
-			return nil
 		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		FriendNotifications []FriendNotification `json:"friend_notifications"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get friend notifications: %w", err)
+	}
+	return responseData.FriendNotifications, nil
+}
+func MarkFriendNotificationsRead(userID, notificationID string) error {
+	where := map[string]interface{}{
+		"user_id": map[string]interface{}{"_eq": userID},
+		"read_at": map[string]interface{}{"_is_null": true},
+	}
+	if notificationID != "" {
+		where["id"] = map[string]interface{}{"_eq": notificationID}
 	}
-
 	mutation := `
-		mutation AddFriend($user_id: String!, $friend_id: String!, $status: String!, $to_accept: String!) {
-			insert_friends_one(object: {user_id: $user_id, friend_id: $friend_id, status: $status, to_accept: $to_accept}) {
-				id
+		mutation MarkFriendNotificationsRead($where: friend_notifications_bool_exp!, $readAt: timestamptz!) {
+			update_friend_notifications(where: $where, _set: {read_at: $readAt}) {
+				affected_rows
 			}
 		}
 	`
-	insertRequestBody := map[string]interface{}{
+	requestBody := map[string]interface{}{
 		"query": mutation,
 		"variables": map[string]interface{}{
-			"user_id":   firstID,
-			"friend_id": secondID,
-			"status":    "pending",
-			"to_accept": friendID,
+			"where":  where,
+			"readAt": time.Now().Format(time.RFC3339Nano),
 		},
 	}
-	jsonBody, err = json.Marshal(insertRequestBody)
-	if err != nil {
-		return fmt.Errorf("failed to create request body: %w", err)
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to mark friend notifications as read: %w", err)
 	}
+	return nil
+}
+func BroadcastFriendNotification(notification FriendNotification) {
+	pusherID := os.Getenv("PUSHER_APP_ID")
+	pusherKey := os.Getenv("PUSHER_APP_KEY")
+	pusherSecret := os.Getenv("PUSHER_APP_SECRET")
 
-	req, err = http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
+	pusherClient := pusher.Client{
+		AppID:   pusherID,
+		Key:     pusherKey,
+		Secret:  pusherSecret,
+		Cluster: "us2",
+		Secure:  true,
+	}
+	err := pusherClient.Trigger(fmt.Sprintf("notifications-%s", notification.UserID), "friend-notification", notification)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		log.Println("Error sending friend notification to Pusher:", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
+}
 
-	resp, err = client.Do(req)
+func insertMentorship(userID, mentorID, menteeID string) error {
+	if mentorID == menteeID {
+		return fmt.Errorf("cannot mentor self")
+	}
+	otherID := mentorID
+	if userID == mentorID {
+		otherID = menteeID
+	}
+	blocked, err := blockuser.IsBlocked(userID, otherID)
 	if err != nil {
-		return fmt.Errorf("failed to send request to Hasura: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if blocked {
+		return ErrMentorshipBlocked
+	}
+	query := `
+		query CheckMentorship($mentor_id: String!, $mentee_id: String!){
+			mentorships(where: {
+				mentor_id: {_eq: $mentor_id},
+				mentee_id: {_eq: $mentee_id}
+			}){
+				id
+				to_accept
+				status
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"mentor_id": mentorID,
+			"mentee_id": menteeID,
+		},
+	}
+	var responseData struct {
+		Mentorships []struct {
+			ID       interface{} `json:"id"`
+			ToAccept string      `json:"to_accept"`
+			Status   string      `json:"status"`
+		} `json:"mentorships"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to check mentorship: %w", err)
+	}
+	if len(responseData.Mentorships) > 0 {
+		existingMentorship := responseData.Mentorships[0]
+		if existingMentorship.Status == MentorshipStatusAccepted {
+			return ErrMentorshipExists
+		}
+		if existingMentorship.Status == MentorshipStatusPending && existingMentorship.ToAccept == otherID {
+			return ErrMentorshipRequestSent
+		}
+		if existingMentorship.Status == MentorshipStatusPending {
+			return setMentorshipStatus(userID, mentorID, menteeID, MentorshipStatusAccepted)
+		}
+	}
+	mutation := `
+		mutation AddMentorship($object: mentorships_insert_input!) {
+			insert_mentorships_one(object: $object, on_conflict: {constraint: mentorships_mentor_id_mentee_id_key, update_columns: [status, to_accept], where: {status: {_eq: "declined"}}}) {
+				id
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"mentor_id": mentorID,
+				"mentee_id": menteeID,
+				"status":    MentorshipStatusPending,
+				"to_accept": otherID,
+			},
+		},
+	}
+	var insertData struct {
+		InsertMentorshipsOne *struct {
+			ID interface{} `json:"id"`
+		} `json:"insert_mentorships_one"`
+	}
+	if err := hasura.Request(requestBody, &insertData); err != nil {
+		return fmt.Errorf("failed to save mentorship: %w", err)
+	}
+	if insertData.InsertMentorshipsOne == nil {
+		return ErrMentorshipConflict
 	}
 	return nil
 }
-
-func deleteFriend(userID, friendID string) error {
-	firstID, secondID := userID, friendID
-	if userID > friendID {
-		firstID, secondID = friendID, userID
+func declineMentorship(userID, mentorID, menteeID string) error {
+	return setMentorshipStatus(userID, mentorID, menteeID, MentorshipStatusDeclined)
+}
+func setMentorshipStatus(userID, mentorID, menteeID, status string) error {
+	mutation := `
+		mutation UpdateMentorshipStatus($mentor_id: String!, $mentee_id: String!, $to_accept: String!, $status: String!) {
+			update_mentorships(where: {
+				mentor_id: {_eq: $mentor_id},
+				mentee_id: {_eq: $mentee_id},
+				to_accept: {_eq: $to_accept},
+				status: {_eq: "pending"}
+			}, _set: {status: $status}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"mentor_id": mentorID,
+			"mentee_id": menteeID,
+			"to_accept": userID,
+			"status":    status,
+		},
 	}
-	if userID == friendID {
-		return fmt.Errorf("cannot add self as friend")
+	var responseData struct {
+		UpdateMentorships struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_mentorships"`
 	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to update mentorship: %w", err)
+	}
+	if responseData.UpdateMentorships.AffectedRows == 0 {
+		return ErrNoMentorshipRequest
+	}
+	return nil
+}
+
+func deleteMentorship(mentorID, menteeID string) error {
 	mutation := `
-		mutation DeleteFriendship($first_id: String!, $second_id: String!){
-			delete_friends(where: {
-				user_id: {_eq: $first_id},
-				friend_id: {_eq: $second_id}
+		mutation DeleteMentorship($mentor_id: String!, $mentee_id: String!){
+			delete_mentorships(where: {
+				mentor_id: {_eq: $mentor_id},
+				mentee_id: {_eq: $mentee_id}
 			}){
 				affected_rows
 			}
@@ -305,48 +550,58 @@ func deleteFriend(userID, friendID string) error {
 	requestBody := map[string]interface{}{
 		"query": mutation,
 		"variables": map[string]interface{}{
-			"first_id":  firstID,
-			"second_id": secondID,
+			"mentor_id": mentorID,
+			"mentee_id": menteeID,
 		},
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to create request body: %w", err)
+	var responseData struct {
+		DeleteMentorships struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_mentorships"`
 	}
-
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to delete mentorship: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request to Hasura: %w", err)
+	if responseData.DeleteMentorships.AffectedRows == 0 {
+		return fmt.Errorf("no mentorship row found to delete")
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func GetMentorshipLists(userID string) ([]string, error) {
+	query := `
+		query GetMentorships($userID: String!) {
+			mentors: mentorships(where: {mentee_id: {_eq: $userID}, status: {_neq: "declined"}}) {
+				mentor_id
+			}
+			mentees: mentorships(where: {mentor_id: {_eq: $userID}, status: {_neq: "declined"}}) {
+				mentee_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
 	}
-	var responseBody struct {
-		Data struct {
-			DeleteFriends struct {
-				AffectedRows int `json:"affected_rows"`
-			} `json:"delete_friends"`
-		} `json:"data"`
+	var responseData struct {
+		Mentors []struct {
+			MentorID string `json:"mentor_id"`
+		} `json:"mentors"`
+		Mentees []struct {
+			MenteeID string `json:"mentee_id"`
+		} `json:"mentees"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get mentorships: %w", err)
 	}
-	if responseBody.Data.DeleteFriends.AffectedRows == 0 {
-		return fmt.Errorf("no friendship row found to delete")
+	relatedIDs := []string{}
+	for _, m := range responseData.Mentors {
+		relatedIDs = append(relatedIDs, m.MentorID)
 	}
-
-	return nil
+	for _, m := range responseData.Mentees {
+		relatedIDs = append(relatedIDs, m.MenteeID)
+	}
+	return relatedIDs, nil
 }
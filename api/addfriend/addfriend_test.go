@@ -0,0 +1,174 @@
+package addfriend
+
+import (
+	"api/friends"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var operationName = regexp.MustCompile(`(?:query|mutation)\s+(\w+)`)
+
+type stubFriend struct {
+	ID          int64   `json:"id"`
+	UserID      string  `json:"user_id"`
+	FriendID    string  `json:"friend_id"`
+	ToAccept    string  `json:"to_accept"`
+	Status      string  `json:"status"`
+	RequestedAt string  `json:"requested_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	Note        *string `json:"note"`
+}
+
+type stubHasura struct {
+	mu      sync.Mutex
+	nextID  int64
+	friends []*stubFriend
+	events  map[int64]map[string]interface{}
+}
+
+func newStubHasura(t *testing.T) *stubHasura {
+	stub := &stubHasura{events: map[int64]map[string]interface{}{}}
+	server := httptest.NewServer(http.HandlerFunc(stub.serve))
+	t.Cleanup(server.Close)
+	t.Setenv("HASURA_GRAPHQL_URL", server.URL)
+	t.Setenv("HASURA_GRAPHQL_ADMIN_SECRET", "test")
+	return stub
+}
+func (s *stubHasura) serve(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query     string                     `json:"query"`
+		Variables map[string]json.RawMessage `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := ""
+	if match := operationName.FindStringSubmatch(body.Query); match != nil {
+		name = match[1]
+	}
+	var data interface{}
+	var errorCode, errorMessage string
+	switch name {
+	case "CheckFriendship":
+		var firstID, secondID string
+		json.Unmarshal(body.Variables["first_id"], &firstID)
+		json.Unmarshal(body.Variables["second_id"], &secondID)
+		// Widen the window between reading and writing so concurrent requests interleave.
+		time.Sleep(time.Millisecond)
+		s.mu.Lock()
+		rows := []stubFriend{}
+		for _, friend := range s.friends {
+			if friend.UserID == firstID && friend.FriendID == secondID {
+				rows = append(rows, *friend)
+			}
+		}
+		s.mu.Unlock()
+		data = map[string]interface{}{"friends": rows}
+	case "AddFriend":
+		var friend stubFriend
+		var event map[string]interface{}
+		json.Unmarshal(body.Variables["object"], &friend)
+		json.Unmarshal(body.Variables["event"], &event)
+		s.mu.Lock()
+		conflict := false
+		for _, existing := range s.friends {
+			if existing.UserID == friend.UserID && existing.FriendID == friend.FriendID {
+				conflict = true
+			}
+		}
+		if conflict {
+			errorCode, errorMessage = "constraint-violation", "Uniqueness violation. duplicate key value violates unique constraint \"friends_user_id_friend_id_key\""
+		} else {
+			s.nextID++
+			friend.ID = s.nextID
+			s.friends = append(s.friends, &friend)
+			s.nextID++
+			s.events[s.nextID] = event
+			data = map[string]interface{}{
+				"insert_friends_one":       map[string]interface{}{"id": friend.ID},
+				"insert_friend_events_one": map[string]interface{}{"id": s.nextID},
+			}
+		}
+		s.mu.Unlock()
+	case "UpdateFriendStatus":
+		var id int64
+		var previousStatus string
+		var changes stubFriend
+		var event map[string]interface{}
+		json.Unmarshal(body.Variables["id"], &id)
+		json.Unmarshal(body.Variables["previousStatus"], &previousStatus)
+		json.Unmarshal(body.Variables["changes"], &changes)
+		json.Unmarshal(body.Variables["event"], &event)
+		s.mu.Lock()
+		affectedRows := 0
+		for _, friend := range s.friends {
+			if friend.ID == id && friend.Status == previousStatus {
+				friend.Status = changes.Status
+				friend.UpdatedAt = changes.UpdatedAt
+				affectedRows++
+			}
+		}
+		s.nextID++
+		s.events[s.nextID] = event
+		data = map[string]interface{}{
+			"update_friends":           map[string]interface{}{"affected_rows": affectedRows},
+			"insert_friend_events_one": map[string]interface{}{"id": s.nextID},
+		}
+		s.mu.Unlock()
+	case "DeleteFriendEvent":
+		var id int64
+		json.Unmarshal(body.Variables["id"], &id)
+		s.mu.Lock()
+		delete(s.events, id)
+		s.mu.Unlock()
+		data = map[string]interface{}{"delete_friend_events_by_pk": map[string]interface{}{"id": id}}
+	case "HasRestriction":
+		data = map[string]interface{}{"user_blocks": []interface{}{}}
+	default:
+		errorCode, errorMessage = "not-supported", "operation not supported by stub: "+name
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if errorMessage != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []map[string]interface{}{{"message": errorMessage, "extensions": map[string]string{"code": errorCode}}},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+func TestConcurrentCrossRequestsAcceptOnce(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		stub := newStubHasura(t)
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		pairs := [][2]string{{"user_a", "user_b"}, {"user_b", "user_a"}}
+		for j, pair := range pairs {
+			wg.Add(1)
+			go func(j int, userID, friendID string) {
+				defer wg.Done()
+				_, errs[j] = ApplyFriendOperation(userID, friendID, friends.OperationRequest, "")
+			}(j, pair[0], pair[1])
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("run %d: unexpected error: %s", i, err)
+			}
+		}
+		if len(stub.friends) != 1 {
+			t.Fatalf("run %d: expected exactly one friendship row, got %d", i, len(stub.friends))
+		}
+		if stub.friends[0].Status != friends.StatusAccepted {
+			t.Fatalf("run %d: expected friendship to be %s, got %s", i, friends.StatusAccepted, stub.friends[0].Status)
+		}
+		if len(stub.events) != 2 {
+			t.Fatalf("run %d: expected one event per successful transition, got %d", i, len(stub.events))
+		}
+	}
+}
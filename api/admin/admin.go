@@ -0,0 +1,372 @@
+package admin
+
+import (
+	"api/auditlog"
+	"api/hasura"
+	"api/reports"
+	"api/roles"
+	"api/userdelete"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	OperationLookup      = "lookup"
+	OperationFriendships = "friendships"
+	OperationMessages    = "messages"
+	OperationSuspend     = "suspend"
+	OperationUnsuspend   = "unsuspend"
+	OperationPurge       = "purge"
+
+	MaxMessageMetadata = 200
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type UserRecord struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	Onboarded  bool    `json:"onboarded"`
+	Suspended  *bool   `json:"suspended"`
+	LastSeen   *string `json:"last_seen"`
+	Role       string  `json:"role"`
+	ClerkError string  `json:"clerk_error,omitempty"`
+}
+
+type FriendshipRecord struct {
+	ID          interface{} `json:"id"`
+	UserID      string      `json:"user_id"`
+	FriendID    string      `json:"friend_id"`
+	Status      string      `json:"status"`
+	ToAccept    *string     `json:"to_accept"`
+	RequestedAt *string     `json:"requested_at"`
+	UpdatedAt   *string     `json:"updated_at"`
+}
+
+type MessageRecord struct {
+	ID          interface{} `json:"id"`
+	SenderID    string      `json:"sender_id"`
+	RecipientID string      `json:"recipient_id"`
+	CreatedAt   string      `json:"created_at"`
+	ReportID    *string     `json:"report_id,omitempty"`
+	Content     *string     `json:"content,omitempty"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received admin request")
+	query := r.URL.Query()
+	operation := query.Get("operation")
+	requiredRoles := roles.StaffRoles
+	if r.Method != http.MethodGet && operation != OperationSuspend && operation != OperationUnsuspend {
+		requiredRoles = []string{roles.RoleAdmin}
+	}
+	usr, err := roles.Authorize(r, requiredRoles...)
+	if err != nil {
+		http.Error(w, err.Error(), roles.StatusCode(err))
+		log.Printf("Error authorizing admin request: %s", err)
+		return
+	}
+	log.Printf("Found %s %s", roles.GetRole(usr), usr.ID)
+
+	targetID := query.Get("target_id")
+	if targetID == "" && !(operation == OperationLookup && query.Get("email") != "") {
+		http.Error(w, "Missing target_id query parameter", http.StatusBadRequest)
+		return
+	}
+	var response interface{}
+	switch {
+	case r.Method == http.MethodGet && operation == OperationLookup:
+		response, err = LookupUser(r.Context(), targetID, query.Get("email"))
+	case r.Method == http.MethodGet && operation == OperationFriendships:
+		response, err = GetFriendships(targetID)
+	case r.Method == http.MethodGet && operation == OperationMessages:
+		response, err = GetMessageMetadata(targetID)
+	case r.Method == http.MethodPost && (operation == OperationSuspend || operation == OperationUnsuspend):
+		suspended := operation == OperationSuspend
+		if err = reports.SetSuspended(r.Context(), targetID, suspended); err == nil {
+			err = reports.RecordAction(reports.ModerationAction{
+				ModeratorID: usr.ID,
+				Action:      operation,
+				TargetID:    targetID,
+				Note:        query.Get("note"),
+			})
+		}
+		response = map[string]interface{}{"user_id": targetID, "suspended": suspended}
+	case r.Method == http.MethodPost && operation == OperationPurge:
+		if err = PurgeUser(r.Context(), targetID); err == nil {
+			err = reports.RecordAction(reports.ModerationAction{
+				ModeratorID: usr.ID,
+				Action:      operation,
+				TargetID:    targetID,
+				Note:        query.Get("note"),
+			})
+		}
+		response = map[string]string{"user_id": targetID, "status": "purged"}
+	default:
+		http.Error(w, "Invalid operation or request method", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do admin operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with admin operation %s: %s", operation, err)
+		return
+	}
+	auditlog.Record(r, usr.ID, "admin."+operation, targetID, map[string]interface{}{"email": query.Get("email"), "note": query.Get("note")})
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Admin operation %s successfully completed by %s", operation, usr.ID)
+}
+func LookupUser(ctx context.Context, userID, email string) (*UserRecord, error) {
+	where := map[string]interface{}{"id": map[string]interface{}{"_eq": userID}}
+	if userID == "" {
+		where = map[string]interface{}{"email": map[string]interface{}{"_eq": email}}
+	}
+	query := `
+		query LookupUser($where: users_bool_exp!) {
+			users(where: $where, limit: 1) {
+				id
+				name
+				email
+				onboarded
+				suspended
+				last_seen
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": where,
+		},
+	}
+	var responseData struct {
+		Users []UserRecord `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if len(responseData.Users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	record := responseData.Users[0]
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	usr, err := user.Get(ctx, record.ID)
+	if err != nil {
+		record.ClerkError = err.Error()
+	} else {
+		record.Role = roles.GetRole(usr)
+	}
+	return &record, nil
+}
+func GetFriendships(userID string) ([]FriendshipRecord, error) {
+	query := `
+		query GetFriendships($userID: String!) {
+			friends(where: {_or: [{user_id: {_eq: $userID}}, {friend_id: {_eq: $userID}}]}, order_by: {updated_at: desc}) {
+				id
+				user_id
+				friend_id
+				status
+				to_accept
+				requested_at
+				updated_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		Friends []FriendshipRecord `json:"friends"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get friendships: %w", err)
+	}
+	return responseData.Friends, nil
+}
+func GetMessageMetadata(userID string) ([]MessageRecord, error) {
+	query := `
+		query GetMessageMetadata($userID: String!, $limit: Int!) {
+			messages(where: {_or: [{sender_id: {_eq: $userID}}, {recipient_id: {_eq: $userID}}]}, order_by: {created_at: desc}, limit: $limit) {
+				id
+				sender_id
+				recipient_id
+				created_at
+			}
+			reports(where: {message_id: {_is_null: false}, _or: [{reporter_id: {_eq: $userID}}, {reported_id: {_eq: $userID}}]}) {
+				id
+				message_id
+				evidence
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+			"limit":  MaxMessageMetadata,
+		},
+	}
+	var responseData struct {
+		Messages []MessageRecord `json:"messages"`
+		Reports  []struct {
+			ID        interface{} `json:"id"`
+			MessageID interface{} `json:"message_id"`
+			Evidence  *string     `json:"evidence"`
+		} `json:"reports"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get message metadata: %w", err)
+	}
+	reported := map[string]int{}
+	for i, report := range responseData.Reports {
+		reported[fmt.Sprint(report.MessageID)] = i
+	}
+	for i, message := range responseData.Messages {
+		index, ok := reported[fmt.Sprint(message.ID)]
+		if !ok {
+			continue
+		}
+		report := responseData.Reports[index]
+		reportID := fmt.Sprint(report.ID)
+		responseData.Messages[i].ReportID = &reportID
+		responseData.Messages[i].Content = report.Evidence
+	}
+	return responseData.Messages, nil
+}
+func PurgeUser(ctx context.Context, userID string) error {
+	query := `
+		query GetOwnedProjects($userID: String!) {
+			projects(where: {owner_id: {_eq: $userID}}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var projectData struct {
+		Projects []struct {
+			ID interface{} `json:"id"`
+		} `json:"projects"`
+	}
+	if err := hasura.Request(requestBody, &projectData); err != nil {
+		return fmt.Errorf("failed to get owned projects: %w", err)
+	}
+	projectIDs := make([]interface{}, len(projectData.Projects))
+	for i, project := range projectData.Projects {
+		projectIDs[i] = project.ID
+	}
+	mutation := `
+		mutation PurgeUser($userID: String!, $members: jsonb!, $projectIDs: [bigint!]!) {
+			delete_messages(where: {_or: [{sender_id: {_eq: $userID}}, {recipient_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_notifications(where: {user: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_friend_notifications(where: {_or: [{user_id: {_eq: $userID}}, {actor_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_friend_events(where: {_or: [{user_id: {_eq: $userID}}, {friend_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_friends(where: {_or: [{user_id: {_eq: $userID}}, {friend_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_mentorships(where: {_or: [{mentor_id: {_eq: $userID}}, {mentee_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_passes(where: {_or: [{user_id: {_eq: $userID}}, {passed_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_user_blocks(where: {_or: [{user_id: {_eq: $userID}}, {target_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_project_applications(where: {_or: [{applicant_id: {_eq: $userID}}, {project_id: {_in: $projectIDs}}]}) {
+				affected_rows
+			}
+			delete_projects(where: {owner_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_team_proposals(where: {_or: [{created_by: {_eq: $userID}}, {members: {_contains: $members}}]}) {
+				affected_rows
+			}
+			delete_pair_queue(where: {user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_pair_now_matches(where: {_or: [{initiator_id: {_eq: $userID}}, {partner_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_coffee_chat_pairings(where: {_or: [{user_id: {_eq: $userID}}, {partner_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_invite_redemptions(where: {_or: [{inviter_id: {_eq: $userID}}, {invitee_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_invites(where: {inviter_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_saved_search_matches(where: {_or: [{owner_id: {_eq: $userID}}, {matched_user_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+			delete_saved_search_digests(where: {user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_saved_searches(where: {user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			update_reports(where: {_or: [{reporter_id: {_eq: $userID}}, {reported_id: {_eq: $userID}}]}, _set: {details: "", evidence: null}) {
+				affected_rows
+			}
+			delete_moderation_warnings(where: {user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_message_requests(where: {_or: [{sender_id: {_eq: $userID}}, {recipient_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":     userID,
+			"members":    []string{userID},
+			"projectIDs": projectIDs,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to purge user data: %w", err)
+	}
+	if err := userdelete.DeleteUserFromHasura(userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	if _, err := user.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete Clerk user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package auditlog
+
+import (
+	"api/hasura"
+	"api/roles"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ActorClerkWebhook = "system:clerk"
+	ActorCron         = "system:cron"
+
+	DefaultRetentionDays = 365
+	DefaultPageSize      = 50
+	MaxPageSize          = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor query parameter")
+
+type Cursor struct {
+	CreatedAt string      `json:"created_at"`
+	ID        interface{} `json:"id"`
+}
+
+type Entry struct {
+	ID        interface{}            `json:"id,omitempty"`
+	ActorID   string                 `json:"actor_id"`
+	Action    string                 `json:"action"`
+	TargetID  string                 `json:"target_id"`
+	RequestID string                 `json:"request_id"`
+	IP        string                 `json:"ip"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for audit log")
+	query := r.URL.Query()
+	if query.Get("operation") == "purge" {
+		cronSecret := os.Getenv("CRON_SECRET")
+		if cronSecret == "" || r.Header.Get("Authorization") != "Bearer "+cronSecret {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Printf("Audit log purge called without a valid cron secret")
+			return
+		}
+		purged, err := PurgeExpired(time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to purge audit log: %s", err), http.StatusInternalServerError)
+			log.Printf("Error purging audit log: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+		log.Printf("Purged %d expired audit log entries", purged)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	usr, err := roles.Authorize(r, roles.RoleAdmin)
+	if err != nil {
+		http.Error(w, err.Error(), roles.StatusCode(err))
+		log.Printf("Error authorizing audit log request: %s", err)
+		return
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	cursor, err := DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, ErrInvalidCursor.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := Query(query.Get("actor_id"), query.Get("target_id"), query.Get("action"), cursor, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query audit log: %s", err), http.StatusInternalServerError)
+		log.Printf("Error querying audit log: %s", err)
+		return
+	}
+	Record(r, usr.ID, "audit_log.query", "", map[string]interface{}{
+		"actor_id":  query.Get("actor_id"),
+		"target_id": query.Get("target_id"),
+		"action":    query.Get("action"),
+	})
+	nextCursor := ""
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		nextCursor = EncodeCursor(Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": entries, "next_cursor": nextCursor}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Audit log successfully queried")
+}
+func Record(r *http.Request, actorID, action, targetID string, details map[string]interface{}) {
+	entry := Entry{
+		ActorID:   actorID,
+		Action:    action,
+		TargetID:  targetID,
+		Details:   details,
+		CreatedAt: time.Now().Format(time.RFC3339Nano),
+	}
+	if r != nil {
+		entry.RequestID = RequestID(r)
+		entry.IP = ClientIP(r)
+	}
+	if err := Insert(entry); err != nil {
+		log.Printf("Error recording audit log entry %s by %s on %s: %s", action, actorID, targetID, err)
+	}
+}
+func RequestID(r *http.Request) string {
+	for _, header := range []string{"X-Vercel-Id", "X-Request-Id", "Svix-Id"} {
+		if value := r.Header.Get(header); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+func ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if realIP := r.Header.Get("X-Real-Ip"); realIP != "" {
+		return realIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+func Insert(entry Entry) error {
+	if entry.Details == nil {
+		entry.Details = map[string]interface{}{}
+	}
+	mutation := `
+		mutation InsertAuditLog($object: audit_log_insert_input!) {
+			insert_audit_log_one(object: $object) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": entry,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to insert audit log entry: %w", err)
+	}
+	return nil
+}
+func EncodeCursor(cursor Cursor) string {
+	jsonCursor, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+func DecodeCursor(token string) (Cursor, error) {
+	var cursor Cursor
+	if token == "" {
+		return cursor, nil
+	}
+	jsonCursor, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("failed to decode cursor: %w", err)
+	}
+	if err := json.Unmarshal(jsonCursor, &cursor); err != nil {
+		return cursor, fmt.Errorf("failed to parse cursor: %w", err)
+	}
+	if cursor.CreatedAt == "" || cursor.ID == nil {
+		return cursor, fmt.Errorf("malformed cursor")
+	}
+	return cursor, nil
+}
+func Query(actorID, targetID, action string, cursor Cursor, limit int) ([]Entry, error) {
+	where := map[string]interface{}{}
+	if actorID != "" {
+		where["actor_id"] = map[string]interface{}{"_eq": actorID}
+	}
+	if targetID != "" {
+		where["target_id"] = map[string]interface{}{"_eq": targetID}
+	}
+	if action != "" {
+		where["action"] = map[string]interface{}{"_eq": action}
+	}
+	if cursor.CreatedAt != "" {
+		where["_or"] = []map[string]interface{}{
+			{"created_at": map[string]interface{}{"_lt": cursor.CreatedAt}},
+			{"created_at": map[string]interface{}{"_eq": cursor.CreatedAt}, "id": map[string]interface{}{"_lt": cursor.ID}},
+		}
+	}
+	query := `
+		query GetAuditLog($where: audit_log_bool_exp!, $limit: Int!) {
+			audit_log(where: $where, order_by: [{created_at: desc}, {id: desc}], limit: $limit) {
+				id
+				actor_id
+				action
+				target_id
+				request_id
+				ip
+				details
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": where,
+			"limit": limit,
+		},
+	}
+	var responseData struct {
+		AuditLog []Entry `json:"audit_log"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	return responseData.AuditLog, nil
+}
+func RetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("AUDIT_LOG_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return DefaultRetentionDays
+	}
+	return days
+}
+func PurgeExpired(now time.Time) (int, error) {
+	mutation := `
+		mutation PurgeAuditLog($before: timestamptz!) {
+			delete_audit_log(where: {created_at: {_lt: $before}}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"before": now.AddDate(0, 0, -RetentionDays()).Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		DeleteAuditLog struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_audit_log"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return 0, fmt.Errorf("failed to purge audit log: %w", err)
+	}
+	return responseData.DeleteAuditLog.AffectedRows, nil
+}
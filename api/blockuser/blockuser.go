@@ -0,0 +1,288 @@
+package blockuser
+
+import (
+	"api/auditlog"
+	"api/friends"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	KindBlock = "block"
+	KindMute  = "mute"
+)
+
+var (
+	ErrInvalidKind = errors.New("invalid kind, expected block or mute")
+	ErrSelf        = errors.New("cannot block or mute self")
+)
+
+type Restriction struct {
+	UserID    string `json:"user_id"`
+	TargetID  string `json:"target_id"`
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to block or mute user")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		response, err = GetRestrictions(userID)
+	case http.MethodPost, http.MethodDelete:
+		targetID := query.Get("target_id")
+		kind := query.Get("kind")
+		if targetID == "" || kind == "" {
+			http.Error(w, "Missing target_id or kind query parameter", http.StatusBadRequest)
+			return
+		}
+		status := "added"
+		if r.Method == http.MethodPost {
+			err = Restrict(userID, targetID, kind)
+		} else {
+			err = Unrestrict(userID, targetID, kind)
+			status = "removed"
+		}
+		if errors.Is(err, ErrInvalidKind) || errors.Is(err, ErrSelf) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			auditlog.Record(r, userID, kind+"."+status, targetID, nil)
+		}
+		response = map[string]string{"kind": kind, "status": status}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do block operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with block operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Block operation successfully completed")
+}
+func Restrict(userID, targetID, kind string) error {
+	if kind != KindBlock && kind != KindMute {
+		return ErrInvalidKind
+	}
+	if userID == targetID {
+		return ErrSelf
+	}
+	mutation := `
+		mutation InsertRestriction($object: user_blocks_insert_input!) {
+			insert_user_blocks_one(object: $object, on_conflict: {constraint: user_blocks_user_id_target_id_kind_key, update_columns: []}) {
+				kind
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"user_id":    userID,
+				"target_id":  targetID,
+				"kind":       kind,
+				"created_at": time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to insert %s: %w", kind, err)
+	}
+	if kind == KindBlock {
+		return endFriendship(userID, targetID)
+	}
+	return nil
+}
+func Unrestrict(userID, targetID, kind string) error {
+	if kind != KindBlock && kind != KindMute {
+		return ErrInvalidKind
+	}
+	mutation := `
+		mutation DeleteRestriction($userID: String!, $targetID: String!, $kind: String!) {
+			delete_user_blocks(where: {user_id: {_eq: $userID}, target_id: {_eq: $targetID}, kind: {_eq: $kind}}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":   userID,
+			"targetID": targetID,
+			"kind":     kind,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", kind, err)
+	}
+	return nil
+}
+func endFriendship(userID, targetID string) error {
+	for attempt := 1; attempt <= friends.MaxWriteAttempts; attempt++ {
+		friendship, err := friends.Get(userID, targetID)
+		if err != nil {
+			return err
+		}
+		operation := friends.EndOperation(friendship, userID, time.Now())
+		if operation == "" {
+			return nil
+		}
+		_, err = friends.Apply(userID, targetID, operation, "")
+		if !errors.Is(err, friends.ErrNotFriends) && !errors.Is(err, friends.ErrNoFriendRequest) && !errors.Is(err, friends.ErrFriendConflict) {
+			return err
+		}
+		log.Printf("Friendship between %s and %s changed concurrently, retrying (attempt %d)", userID, targetID, attempt)
+	}
+	return fmt.Errorf("failed to end friendship: friendship kept changing concurrently")
+}
+func GetRestrictions(userID string) ([]Restriction, error) {
+	query := `
+		query GetRestrictions($userID: String!) {
+			user_blocks(where: {user_id: {_eq: $userID}}, order_by: {created_at: desc}) {
+				user_id
+				target_id
+				kind
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		UserBlocks []Restriction `json:"user_blocks"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get blocks: %w", err)
+	}
+	return responseData.UserBlocks, nil
+}
+func GetBlockedIDs(userID string) ([]string, error) {
+	query := `
+		query GetBlockedIDs($userID: String!) {
+			blocked: user_blocks(where: {user_id: {_eq: $userID}, kind: {_eq: "block"}}) {
+				target_id
+			}
+			blockedBy: user_blocks(where: {target_id: {_eq: $userID}, kind: {_eq: "block"}}) {
+				user_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		Blocked []struct {
+			TargetID string `json:"target_id"`
+		} `json:"blocked"`
+		BlockedBy []struct {
+			UserID string `json:"user_id"`
+		} `json:"blockedBy"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+	blockedIDs := []string{}
+	for _, block := range responseData.Blocked {
+		blockedIDs = append(blockedIDs, block.TargetID)
+	}
+	for _, block := range responseData.BlockedBy {
+		blockedIDs = append(blockedIDs, block.UserID)
+	}
+	return blockedIDs, nil
+}
+func hasRestriction(userIDs, targetIDs []string, kind string) (bool, error) {
+	query := `
+		query HasRestriction($userIDs: [String!]!, $targetIDs: [String!]!, $kind: String!) {
+			user_blocks(where: {user_id: {_in: $userIDs}, target_id: {_in: $targetIDs}, kind: {_eq: $kind}}, limit: 1) {
+				user_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userIDs":   userIDs,
+			"targetIDs": targetIDs,
+			"kind":      kind,
+		},
+	}
+	var responseData struct {
+		UserBlocks []struct {
+			UserID string `json:"user_id"`
+		} `json:"user_blocks"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", kind, err)
+	}
+	return len(responseData.UserBlocks) > 0, nil
+}
+func IsBlocked(userID, otherID string) (bool, error) {
+	ids := []string{userID, otherID}
+	if userID == otherID {
+		return false, nil
+	}
+	return hasRestriction(ids, ids, KindBlock)
+}
+func IsMuted(recipientID, senderID string) (bool, error) {
+	return hasRestriction([]string{recipientID}, []string{senderID}, KindMute)
+}
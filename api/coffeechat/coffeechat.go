@@ -0,0 +1,297 @@
+package coffeechat
+
+import (
+	"api/auditlog"
+	"api/blockuser"
+	"api/getoverlap"
+	"api/hasura"
+	"api/messagerequests"
+	"api/sendmessage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRepeatWeeks = 4
+	OverlapDays        = 7
+)
+
+var Icebreakers = []string{
+	"What's a project you've been wanting to build but haven't started yet?",
+	"What's the most interesting bug you've tracked down recently?",
+	"Which language or tool have you been meaning to learn this year?",
+	"What got you into programming in the first place?",
+	"What's a piece of code you're proud of?",
+	"If you could pair with anyone on any codebase, what would it be?",
+}
+
+type Participant struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Language  []string `json:"language"`
+	Interests []string `json:"interests"`
+}
+
+type Pairing struct {
+	UserID       string  `json:"user_id"`
+	PartnerID    string  `json:"partner_id"`
+	OverlapHours float64 `json:"overlap_hours"`
+}
+
+type candidatePair struct {
+	a, b         int
+	overlapHours float64
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to run coffee chat pairing")
+	cronSecret := os.Getenv("CRON_SECRET")
+	if cronSecret == "" || r.Header.Get("Authorization") != "Bearer "+cronSecret {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Coffee chat pairing called without a valid cron secret")
+		return
+	}
+	participants, err := GetParticipants()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get coffee chat participants: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting coffee chat participants: %s", err)
+		return
+	}
+	ids := make([]string, len(participants))
+	for i, p := range participants {
+		ids[i] = p.ID
+	}
+	since := time.Now().AddDate(0, 0, -7*RepeatWeeks())
+	recent, err := GetRecentPairings(since)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get recent pairings: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting recent pairings: %s", err)
+		return
+	}
+	for _, p := range participants {
+		blockedIDs, err := blockuser.GetBlockedIDs(p.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get blocked users: %s", err), http.StatusInternalServerError)
+			log.Printf("Error getting blocked users: %s", err)
+			return
+		}
+		for _, blockedID := range blockedIDs {
+			recent[pairKey(p.ID, blockedID)] = true
+		}
+	}
+	schedules, err := getoverlap.GetSchedules(ids)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get schedules: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting schedules: %s", err)
+		return
+	}
+	pairings := PairParticipants(participants, schedules, recent, time.Now())
+	created := []Pairing{}
+	for _, pairing := range pairings {
+		if err := CreatePairing(pairing, participants); err != nil {
+			log.Printf("Error creating coffee chat pairing for %s and %s: %s", pairing.UserID, pairing.PartnerID, err)
+			continue
+		}
+		auditlog.Record(r, auditlog.ActorCron, "coffee_chat.pair", pairing.UserID, map[string]interface{}{"partner_id": pairing.PartnerID, "conversation": "accepted"})
+		created = append(created, pairing)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"participants": len(participants),
+		"pairings":     created,
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Coffee chat pairing successfully completed with %d pairs", len(created))
+}
+func RepeatWeeks() int {
+	weeks := DefaultRepeatWeeks
+	if s := os.Getenv("COFFEE_CHAT_REPEAT_WEEKS"); s != "" {
+		if parsedWeeks, err := strconv.Atoi(s); err == nil && parsedWeeks >= 0 {
+			weeks = parsedWeeks
+		}
+	}
+	return weeks
+}
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+func PairParticipants(participants []Participant, schedules map[string]getoverlap.Schedule, recent map[string]bool, from time.Time) []Pairing {
+	order := rand.Perm(len(participants))
+	candidates := []candidatePair{}
+	for i := 0; i < len(order); i++ {
+		for j := i + 1; j < len(order); j++ {
+			a, b := participants[order[i]], participants[order[j]]
+			if recent[pairKey(a.ID, b.ID)] {
+				continue
+			}
+			scheduleA, hasA := schedules[a.ID]
+			scheduleB, hasB := schedules[b.ID]
+			hours := 0.0
+			if hasA && hasB && len(scheduleA.Availability) > 0 && len(scheduleB.Availability) > 0 {
+				hours = getoverlap.TotalHours(getoverlap.OverlapSlots(scheduleA, scheduleB, from, OverlapDays))
+				if hours == 0 {
+					continue
+				}
+			}
+			candidates = append(candidates, candidatePair{a: order[i], b: order[j], overlapHours: hours})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].overlapHours > candidates[j].overlapHours
+	})
+	paired := make(map[int]bool, len(participants))
+	pairings := []Pairing{}
+	for _, c := range candidates {
+		if paired[c.a] || paired[c.b] {
+			continue
+		}
+		paired[c.a] = true
+		paired[c.b] = true
+		pairings = append(pairings, Pairing{
+			UserID:       participants[c.a].ID,
+			PartnerID:    participants[c.b].ID,
+			OverlapHours: c.overlapHours,
+		})
+	}
+	return pairings
+}
+func Icebreaker(a, b Participant) string {
+	shared := []string{}
+	for _, la := range a.Language {
+		for _, lb := range b.Language {
+			if strings.EqualFold(la, lb) {
+				shared = append(shared, la)
+			}
+		}
+	}
+	message := fmt.Sprintf("☕ You've been paired for this week's coffee chat, %s and %s!", a.Name, b.Name)
+	if len(shared) > 0 {
+		message += fmt.Sprintf(" You both work with %s.", strings.Join(shared, ", "))
+	}
+	return message + " Icebreaker: " + Icebreakers[rand.Intn(len(Icebreakers))]
+}
+func CreatePairing(pairing Pairing, participants []Participant) error {
+	var a, b Participant
+	for _, p := range participants {
+		if p.ID == pairing.UserID {
+			a = p
+		} else if p.ID == pairing.PartnerID {
+			b = p
+		}
+	}
+	if err := RecordPairing(pairing); err != nil {
+		return err
+	}
+	if err := messagerequests.OpenConversation(a.ID, b.ID); err != nil {
+		return err
+	}
+	content := Icebreaker(a, b)
+	encryptionKey := sendmessage.GenerateEncryptionKey(a.ID, os.Getenv("ENCRYPTION_KEY"))
+	encryptedContent, iv, err := sendmessage.EncryptMessage(content, encryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt icebreaker: %w", err)
+	}
+	if err := sendmessage.StoreSystemMessage(a.ID, b.ID, encryptedContent, iv); err != nil {
+		return fmt.Errorf("failed to send icebreaker: %w", err)
+	}
+	sendmessage.BroadcastMessage(sendmessage.MessagePusher{
+		SenderID:         a.ID,
+		RecipientID:      b.ID,
+		EncryptedContent: content,
+		CreatedAt:        time.Now().Format(time.RFC3339Nano),
+		System:           true,
+	})
+	for _, pair := range [][2]string{{b.ID, a.ID}, {a.ID, b.ID}} {
+		if err := sendmessage.UpdateNotifications(pair[0], pair[1]); err != nil {
+			return fmt.Errorf("failed to update notifications: %w", err)
+		}
+		sendmessage.BroadcastNotification(pair[0], pair[1])
+	}
+	return nil
+}
+func GetParticipants() ([]Participant, error) {
+	query := `
+		query GetCoffeeChatParticipants {
+			users(where: {coffee_chat_opt_in: {_eq: true}, suspended: {_neq: true}}) {
+				id
+				name
+				language
+				interests
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+	}
+	var responseData struct {
+		Users []Participant `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, err
+	}
+	return responseData.Users, nil
+}
+func GetRecentPairings(since time.Time) (map[string]bool, error) {
+	query := `
+		query GetRecentPairings($since: timestamptz!) {
+			coffee_chat_pairings(where: {paired_at: {_gte: $since}}) {
+				user_id
+				partner_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"since": since.Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		CoffeeChatPairings []Pairing `json:"coffee_chat_pairings"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, err
+	}
+	recent := make(map[string]bool, len(responseData.CoffeeChatPairings))
+	for _, p := range responseData.CoffeeChatPairings {
+		recent[pairKey(p.UserID, p.PartnerID)] = true
+	}
+	return recent, nil
+}
+func RecordPairing(pairing Pairing) error {
+	mutation := `
+		mutation RecordPairing($userID: String!, $partnerID: String!, $overlapHours: numeric!, $pairedAt: timestamptz!) {
+			insert_coffee_chat_pairings_one(object: {user_id: $userID, partner_id: $partnerID, overlap_hours: $overlapHours, paired_at: $pairedAt}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":       pairing.UserID,
+			"partnerID":    pairing.PartnerID,
+			"overlapHours": pairing.OverlapHours,
+			"pairedAt":     time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to record pairing: %w", err)
+	}
+	return nil
+}
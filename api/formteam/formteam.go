@@ -0,0 +1,559 @@
+package formteam
+
+import (
+	"api/getrequests"
+	"api/getusers"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	MinTeamSize        = 3
+	MaxTeamSize        = 5
+	CandidatePoolSize  = 40
+	BeamWidth          = 20
+	MaxProposals       = 5
+	MinDistinctMembers = 2
+)
+
+type TeamRequest struct {
+	UserID     string         `json:"user_id"`
+	Operation  string         `json:"operation"`
+	SeedIDs    []string       `json:"seed_ids"`
+	Size       int            `json:"size"`
+	Roles      map[string]int `json:"roles"`
+	ProposalID interface{}    `json:"proposal_id"`
+}
+
+type Member struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Email          string   `json:"email"`
+	ProfilePicture string   `json:"profile_picture"`
+	Language       []string `json:"language"`
+	Specialty      string   `json:"specialty"`
+	Interests      []string `json:"interests"`
+}
+
+type Proposal struct {
+	ID           interface{}    `json:"id"`
+	Members      []Member       `json:"members"`
+	Score        float64        `json:"score"`
+	Languages    []string       `json:"languages"`
+	Specialties  []string       `json:"specialties"`
+	MissingRoles map[string]int `json:"missing_roles"`
+	AcceptedBy   []string       `json:"accepted_by"`
+	Status       string         `json:"status"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to form a team")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	var teamReq TeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&teamReq); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+		log.Printf("Error decoding JSON payload: %s", err)
+		return
+	}
+	if teamReq.UserID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, teamReq.UserID)
+		return
+	}
+	updateseen.UpdateUserInHasura(teamReq.UserID)
+
+	var response interface{}
+	if teamReq.Operation == "" || teamReq.Operation == "propose" {
+		if teamReq.Size < MinTeamSize || teamReq.Size > MaxTeamSize {
+			http.Error(w, fmt.Sprintf("Team size must be between %d and %d", MinTeamSize, MaxTeamSize), http.StatusBadRequest)
+			return
+		}
+		if len(teamReq.SeedIDs)+1 > teamReq.Size {
+			http.Error(w, "Too many seed members for the requested team size", http.StatusBadRequest)
+			return
+		}
+		roleTotal := 0
+		for _, count := range teamReq.Roles {
+			if count < 0 {
+				http.Error(w, "Role counts must not be negative", http.StatusBadRequest)
+				return
+			}
+			roleTotal += count
+		}
+		if roleTotal > teamReq.Size {
+			http.Error(w, "Role mix requires more members than the team size", http.StatusBadRequest)
+			return
+		}
+		response, err = ProposeTeams(teamReq)
+	} else if teamReq.Operation == "list" {
+		response, err = ListProposals(teamReq.UserID)
+	} else if teamReq.Operation == "accept" || teamReq.Operation == "decline" {
+		if teamReq.ProposalID == nil {
+			http.Error(w, "Missing proposal_id", http.StatusBadRequest)
+			return
+		}
+		response, err = RespondToProposal(teamReq.UserID, teamReq.ProposalID, teamReq.Operation == "accept")
+	} else {
+		http.Error(w, "Invalid operation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do team operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with team operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Team operation successfully completed")
+}
+func ProposeTeams(teamReq TeamRequest) ([]Proposal, error) {
+	friendIDs, err := getrequests.GetFriendLists(teamReq.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friends: %w", err)
+	}
+	isFriend := make(map[string]bool, len(friendIDs))
+	for _, id := range friendIDs {
+		isFriend[id] = true
+	}
+	for _, id := range teamReq.SeedIDs {
+		if !isFriend[id] {
+			return nil, fmt.Errorf("seed member %s is not a friend", id)
+		}
+	}
+	known, err := getrequests.GetUsersInfo(append([]string{teamReq.UserID}, friendIDs...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friends info: %w", err)
+	}
+	pool := make(map[string]Member)
+	for _, u := range known {
+		pool[u.ID] = Member{ID: u.ID, Name: u.Name, Email: u.Email, ProfilePicture: u.ProfilePicture, Language: u.Language, Specialty: u.Specialty, Interests: u.Interests}
+	}
+	recommended, err := getusers.GetUsersFromHasura(CandidatePoolSize, teamReq.UserID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candidate pool: %w", err)
+	}
+	for _, u := range recommended {
+		pool[u.ID] = Member{ID: u.ID, Name: u.Name, Email: u.Email, ProfilePicture: u.ProfilePicture, Language: u.Language, Specialty: u.Specialty, Interests: u.Interests}
+	}
+	if _, ok := pool[teamReq.UserID]; !ok {
+		return nil, fmt.Errorf("user %s not found", teamReq.UserID)
+	}
+	base := []Member{pool[teamReq.UserID]}
+	for _, id := range teamReq.SeedIDs {
+		base = append(base, pool[id])
+	}
+	candidates := []Member{}
+	for id, m := range pool {
+		inBase := false
+		for _, b := range base {
+			if b.ID == id {
+				inBase = true
+			}
+		}
+		if !inBase {
+			candidates = append(candidates, m)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID < candidates[j].ID
+	})
+	teams := SearchTeams(base, candidates, teamReq.Size, teamReq.Roles)
+	proposals := []Proposal{}
+	for _, team := range teams {
+		proposal := describeTeam(team, teamReq.Roles)
+		proposal.Status = "proposed"
+		proposal.AcceptedBy = []string{teamReq.UserID}
+		proposals = append(proposals, proposal)
+	}
+	if err := insertProposals(teamReq.UserID, teamReq.Roles, proposals); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+func SearchTeams(base, candidates []Member, size int, roles map[string]int) [][]Member {
+	type scoredTeam struct {
+		team  []Member
+		score float64
+	}
+	beam := []scoredTeam{{team: base, score: ScoreTeam(base, roles)}}
+	for len(beam) > 0 && len(beam[0].team) < size {
+		seen := make(map[string]bool)
+		next := []scoredTeam{}
+		for _, scored := range beam {
+			for _, candidate := range candidates {
+				if containsMember(scored.team, candidate.ID) {
+					continue
+				}
+				expanded := append(append([]Member{}, scored.team...), candidate)
+				key := teamKey(expanded)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				next = append(next, scoredTeam{team: expanded, score: ScoreTeam(expanded, roles)})
+			}
+		}
+		sort.SliceStable(next, func(i, j int) bool {
+			return next[i].score > next[j].score
+		})
+		if len(next) > BeamWidth {
+			next = next[:BeamWidth]
+		}
+		beam = next
+	}
+	minDistinct := min(MinDistinctMembers, size-len(base))
+	teams := [][]Member{}
+	for _, scored := range beam {
+		if len(teams) == MaxProposals {
+			break
+		}
+		diverse := true
+		for _, team := range teams {
+			if distinctMembers(scored.team, team) < minDistinct {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			teams = append(teams, scored.team)
+		}
+	}
+	return teams
+}
+func distinctMembers(team, other []Member) int {
+	distinct := 0
+	for _, m := range team {
+		if !containsMember(other, m.ID) {
+			distinct++
+		}
+	}
+	return distinct
+}
+func ScoreTeam(team []Member, roles map[string]int) float64 {
+	languages := make(map[string]bool)
+	specialties := make(map[string]int)
+	interests := make(map[string]int)
+	for _, m := range team {
+		for _, language := range m.Language {
+			languages[language] = true
+		}
+		if m.Specialty != "" {
+			specialties[m.Specialty]++
+		}
+		for _, interest := range m.Interests {
+			interests[interest]++
+		}
+	}
+	score := float64(len(languages)) + 2*float64(len(specialties))
+	for role, count := range roles {
+		filled := specialties[role]
+		if filled > count {
+			filled = count
+		}
+		score += 3 * float64(filled)
+	}
+	for _, count := range interests {
+		if count > 1 {
+			score += float64(count*(count-1)) / 2
+		}
+	}
+	return score
+}
+func describeTeam(team []Member, roles map[string]int) Proposal {
+	languages := make(map[string]bool)
+	specialties := make(map[string]int)
+	for _, m := range team {
+		for _, language := range m.Language {
+			languages[language] = true
+		}
+		if m.Specialty != "" {
+			specialties[m.Specialty]++
+		}
+	}
+	proposal := Proposal{
+		Members:      team,
+		Score:        ScoreTeam(team, roles),
+		Languages:    []string{},
+		Specialties:  []string{},
+		MissingRoles: map[string]int{},
+	}
+	for language := range languages {
+		proposal.Languages = append(proposal.Languages, language)
+	}
+	for specialty := range specialties {
+		proposal.Specialties = append(proposal.Specialties, specialty)
+	}
+	sort.Strings(proposal.Languages)
+	sort.Strings(proposal.Specialties)
+	for role, count := range roles {
+		if specialties[role] < count {
+			proposal.MissingRoles[role] = count - specialties[role]
+		}
+	}
+	return proposal
+}
+func containsMember(team []Member, id string) bool {
+	for _, m := range team {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+func teamKey(team []Member) string {
+	ids := make([]string, len(team))
+	for i, m := range team {
+		ids[i] = m.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+func memberIDs(team []Member) []string {
+	ids := make([]string, len(team))
+	for i, m := range team {
+		ids[i] = m.ID
+	}
+	return ids
+}
+func insertProposals(userID string, roles map[string]int, proposals []Proposal) error {
+	if len(proposals) == 0 {
+		return nil
+	}
+	mutation := `
+		mutation InsertTeamProposals($objects: [team_proposals_insert_input!]!) {
+			insert_team_proposals(objects: $objects) {
+				returning {
+					id
+				}
+			}
+		}
+	`
+	objects := []map[string]interface{}{}
+	createdAt := time.Now().Format(time.RFC3339Nano)
+	for _, proposal := range proposals {
+		objects = append(objects, map[string]interface{}{
+			"created_by":  userID,
+			"members":     memberIDs(proposal.Members),
+			"accepted_by": proposal.AcceptedBy,
+			"score":       proposal.Score,
+			"roles":       roles,
+			"status":      proposal.Status,
+			"created_at":  createdAt,
+		})
+	}
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"objects": objects,
+		},
+	}
+	var responseData struct {
+		InsertTeamProposals struct {
+			Returning []struct {
+				ID interface{} `json:"id"`
+			} `json:"returning"`
+		} `json:"insert_team_proposals"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to insert team proposals: %w", err)
+	}
+	for i, returned := range responseData.InsertTeamProposals.Returning {
+		if i < len(proposals) {
+			proposals[i].ID = returned.ID
+		}
+	}
+	return nil
+}
+func ListProposals(userID string) ([]Proposal, error) {
+	query := `
+		query GetTeamProposals($userID: jsonb!) {
+			team_proposals(where: {members: {_contains: $userID}, status: {_in: ["proposed", "formed"]}}, order_by: {score: desc}) {
+				id
+				members
+				accepted_by
+				score
+				roles
+				status
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": []string{userID},
+		},
+	}
+	var responseData struct {
+		TeamProposals []struct {
+			ID         interface{}    `json:"id"`
+			Members    []string       `json:"members"`
+			AcceptedBy []string       `json:"accepted_by"`
+			Score      float64        `json:"score"`
+			Roles      map[string]int `json:"roles"`
+			Status     string         `json:"status"`
+		} `json:"team_proposals"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get team proposals: %w", err)
+	}
+	allIDs := []string{}
+	for _, p := range responseData.TeamProposals {
+		allIDs = append(allIDs, p.Members...)
+	}
+	users, err := getrequests.GetUsersInfo(allIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members info: %w", err)
+	}
+	members := make(map[string]Member, len(users))
+	for _, u := range users {
+		members[u.ID] = Member{ID: u.ID, Name: u.Name, Email: u.Email, ProfilePicture: u.ProfilePicture, Language: u.Language, Specialty: u.Specialty, Interests: u.Interests}
+	}
+	proposals := []Proposal{}
+	for _, p := range responseData.TeamProposals {
+		team := []Member{}
+		for _, id := range p.Members {
+			if m, ok := members[id]; ok {
+				team = append(team, m)
+			}
+		}
+		proposal := describeTeam(team, p.Roles)
+		proposal.ID = p.ID
+		proposal.Score = p.Score
+		proposal.AcceptedBy = p.AcceptedBy
+		proposal.Status = p.Status
+		proposals = append(proposals, proposal)
+	}
+	return proposals, nil
+}
+func RespondToProposal(userID string, proposalID interface{}, accept bool) (map[string]string, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		query := `
+			query GetTeamProposal($id: bigint!) {
+				team_proposals_by_pk(id: $id) {
+					members
+					accepted_by
+					status
+				}
+			}
+		`
+		requestBody := map[string]interface{}{
+			"query": query,
+			"variables": map[string]interface{}{
+				"id": proposalID,
+			},
+		}
+		var responseData struct {
+			Proposal *struct {
+				Members    []string `json:"members"`
+				AcceptedBy []string `json:"accepted_by"`
+				Status     string   `json:"status"`
+			} `json:"team_proposals_by_pk"`
+		}
+		if err := hasura.Request(requestBody, &responseData); err != nil {
+			return nil, fmt.Errorf("failed to get team proposal: %w", err)
+		}
+		proposal := responseData.Proposal
+		if proposal == nil {
+			return nil, fmt.Errorf("team proposal not found")
+		}
+		isMember := false
+		for _, id := range proposal.Members {
+			if id == userID {
+				isMember = true
+			}
+		}
+		if !isMember {
+			return nil, fmt.Errorf("user is not a member of this team proposal")
+		}
+		if proposal.Status != "proposed" {
+			return nil, fmt.Errorf("team proposal is already %s", proposal.Status)
+		}
+		status := "declined"
+		acceptedBy := append([]string{}, proposal.AcceptedBy...)
+		if accept {
+			status = "proposed"
+			alreadyAccepted := false
+			for _, id := range acceptedBy {
+				if id == userID {
+					alreadyAccepted = true
+				}
+			}
+			if !alreadyAccepted {
+				acceptedBy = append(acceptedBy, userID)
+			}
+			if len(acceptedBy) == len(proposal.Members) {
+				status = "formed"
+			}
+		}
+		mutation := `
+			mutation UpdateTeamProposal($id: bigint!, $previousAcceptedBy: jsonb!, $acceptedBy: jsonb!, $status: String!) {
+				update_team_proposals(
+					where: {id: {_eq: $id}, status: {_eq: "proposed"}, accepted_by: {_eq: $previousAcceptedBy}},
+					_set: {accepted_by: $acceptedBy, status: $status}
+				) {
+					affected_rows
+				}
+			}
+		`
+		requestBody = map[string]interface{}{
+			"query": mutation,
+			"variables": map[string]interface{}{
+				"id":                 proposalID,
+				"previousAcceptedBy": proposal.AcceptedBy,
+				"acceptedBy":         acceptedBy,
+				"status":             status,
+			},
+		}
+		var updateData struct {
+			UpdateTeamProposals struct {
+				AffectedRows int `json:"affected_rows"`
+			} `json:"update_team_proposals"`
+		}
+		if err := hasura.Request(requestBody, &updateData); err != nil {
+			return nil, fmt.Errorf("failed to update team proposal: %w", err)
+		}
+		if updateData.UpdateTeamProposals.AffectedRows == 1 {
+			return map[string]string{"status": status}, nil
+		}
+		log.Printf("Team proposal %v changed concurrently, retrying", proposalID)
+	}
+	return nil, fmt.Errorf("team proposal is being updated by other members, try again")
+}
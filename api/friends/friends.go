@@ -0,0 +1,396 @@
+package friends
+
+import (
+	"api/hasura"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	StatusRequested = "requested"
+	StatusAccepted  = "accepted"
+	StatusDeclined  = "declined"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+	StatusRemoved   = "removed"
+
+	OperationAdd          = "add"
+	OperationRequest      = "request"
+	OperationAccept       = "accept"
+	OperationDecline      = "decline"
+	OperationCancel       = "cancel"
+	OperationRemove       = "remove"
+	OperationEditNote     = "edit_note"
+	OperationWithdrawNote = "withdraw_note"
+
+	DefaultRequestExpiryDays   = 30
+	DefaultDeclineCooldownDays = 14
+	MaxWriteAttempts           = 3
+	MaxNoteLength              = 280
+)
+
+var (
+	ErrFriendshipExists  = errors.New("friendship already exists")
+	ErrFriendRequestSent = errors.New("friend request already sent")
+	ErrDeclineCooldown   = errors.New("friend request was declined recently, try again later")
+	ErrNoFriendRequest   = errors.New("no open friend request found")
+	ErrNotFriends        = errors.New("users are not friends")
+	ErrInvalidOperation  = errors.New("invalid operation")
+	ErrFriendConflict    = errors.New("friendship was changed concurrently, please retry")
+	ErrNoteTooLong       = fmt.Errorf("note must be at most %d characters", MaxNoteLength)
+	ErrSelf              = errors.New("cannot add self as friend")
+)
+
+type Friendship struct {
+	ID          interface{} `json:"id"`
+	UserID      string      `json:"user_id"`
+	FriendID    string      `json:"friend_id"`
+	Status      string      `json:"status"`
+	ToAccept    string      `json:"to_accept"`
+	RequestedAt string      `json:"requested_at"`
+	UpdatedAt   string      `json:"updated_at"`
+	Note        *string     `json:"note"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for friendship status")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	friendID := query.Get("friend_id")
+	if userID == "" || friendID == "" {
+		http.Error(w, "Missing user_id or friend_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	friendship, err := Get(userID, friendID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get friendship: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting friendship: %s", err)
+		return
+	}
+	response := map[string]interface{}{"status": EffectiveStatus(friendship, time.Now())}
+	if friendship != nil {
+		response["to_accept"] = friendship.ToAccept
+		response["note"] = friendship.Note
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Friendship status successfully retrieved")
+}
+func RequestExpiry() time.Duration {
+	days := DefaultRequestExpiryDays
+	if d := os.Getenv("FRIEND_REQUEST_EXPIRY_DAYS"); d != "" {
+		if parsedDays, err := strconv.Atoi(d); err == nil && parsedDays > 0 {
+			days = parsedDays
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+func DeclineCooldown() time.Duration {
+	days := DefaultDeclineCooldownDays
+	if d := os.Getenv("FRIEND_DECLINE_COOLDOWN_DAYS"); d != "" {
+		if parsedDays, err := strconv.Atoi(d); err == nil && parsedDays >= 0 {
+			days = parsedDays
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+func EffectiveStatus(friendship *Friendship, now time.Time) string {
+	if friendship == nil {
+		return ""
+	}
+	if friendship.Status == StatusRequested {
+		if requestedAt, err := time.Parse(time.RFC3339Nano, friendship.RequestedAt); err == nil && now.Sub(requestedAt) > RequestExpiry() {
+			return StatusExpired
+		}
+	}
+	return friendship.Status
+}
+func Transition(friendship *Friendship, actorID, operation string, now time.Time) (string, error) {
+	status := EffectiveStatus(friendship, now)
+	incoming := friendship != nil && friendship.ToAccept == actorID
+	switch operation {
+	case OperationRequest, OperationAdd:
+		switch status {
+		case StatusAccepted:
+			return "", ErrFriendshipExists
+		case StatusRequested:
+			if incoming {
+				return StatusAccepted, nil
+			}
+			return "", ErrFriendRequestSent
+		case StatusDeclined:
+			if !incoming {
+				if updatedAt, err := time.Parse(time.RFC3339Nano, friendship.UpdatedAt); err == nil && now.Sub(updatedAt) < DeclineCooldown() {
+					return "", ErrDeclineCooldown
+				}
+			}
+		}
+		return StatusRequested, nil
+	case OperationAccept, OperationDecline:
+		if status != StatusRequested || !incoming {
+			return "", ErrNoFriendRequest
+		}
+		if operation == OperationAccept {
+			return StatusAccepted, nil
+		}
+		return StatusDeclined, nil
+	case OperationCancel:
+		if status != StatusRequested || incoming {
+			return "", ErrNoFriendRequest
+		}
+		return StatusCancelled, nil
+	case OperationRemove:
+		if status != StatusAccepted {
+			return "", ErrNotFriends
+		}
+		return StatusRemoved, nil
+	case OperationEditNote, OperationWithdrawNote:
+		if status != StatusRequested || incoming {
+			return "", ErrNoFriendRequest
+		}
+		return StatusRequested, nil
+	}
+	return "", ErrInvalidOperation
+}
+func Get(userID, friendID string) (*Friendship, error) {
+	firstID, secondID := userID, friendID
+	if userID > friendID {
+		firstID, secondID = friendID, userID
+	}
+	query := `
+		query CheckFriendship($first_id: String!, $second_id: String!){
+			friends(where: {
+				user_id: {_eq: $first_id},
+				friend_id: {_eq: $second_id}
+			}){
+				id
+				user_id
+				friend_id
+				to_accept
+				status
+				requested_at
+				updated_at
+				note
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"first_id":  firstID,
+			"second_id": secondID,
+		},
+	}
+	var responseData struct {
+		Friends []Friendship `json:"friends"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to check friendship: %w", err)
+	}
+	if len(responseData.Friends) == 0 {
+		return nil, nil
+	}
+	return &responseData.Friends[0], nil
+}
+func EndOperation(friendship *Friendship, actorID string, now time.Time) string {
+	switch EffectiveStatus(friendship, now) {
+	case StatusAccepted:
+		return OperationRemove
+	case StatusRequested:
+		if friendship.ToAccept == actorID {
+			return OperationDecline
+		}
+		return OperationCancel
+	}
+	return ""
+}
+func Apply(userID, friendID, operation, note string) (string, error) {
+	if userID == friendID {
+		return "", ErrSelf
+	}
+	if len([]rune(note)) > MaxNoteLength {
+		return "", ErrNoteTooLong
+	}
+	for attempt := 1; ; attempt++ {
+		status, err := apply(userID, friendID, operation, note)
+		if !errors.Is(err, ErrFriendConflict) || attempt == MaxWriteAttempts {
+			return status, err
+		}
+		log.Printf("Friendship between %s and %s changed concurrently, retrying (attempt %d)", userID, friendID, attempt)
+	}
+}
+func apply(userID, friendID, operation, note string) (string, error) {
+	friendship, err := Get(userID, friendID)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	status, err := Transition(friendship, userID, operation, now)
+	if err != nil {
+		return "", err
+	}
+	firstID, secondID := userID, friendID
+	if userID > friendID {
+		firstID, secondID = friendID, userID
+	}
+	fromStatus := EffectiveStatus(friendship, now)
+	changes := map[string]interface{}{
+		"status":     status,
+		"updated_at": now.Format(time.RFC3339Nano),
+	}
+	var noteValue interface{}
+	if note != "" && operation != OperationWithdrawNote {
+		noteValue = note
+	}
+	noteOnly := operation == OperationEditNote || operation == OperationWithdrawNote
+	if noteOnly {
+		changes["note"] = noteValue
+	} else if status == StatusRequested {
+		changes["to_accept"] = friendID
+		changes["requested_at"] = now.Format(time.RFC3339Nano)
+		changes["note"] = noteValue
+	}
+	event := map[string]interface{}{
+		"user_id":     firstID,
+		"friend_id":   secondID,
+		"actor_id":    userID,
+		"from_status": fromStatus,
+		"to_status":   status,
+		"created_at":  now.Format(time.RFC3339Nano),
+	}
+	if friendship == nil {
+		mutation := `
+			mutation AddFriend($object: friends_insert_input!, $event: friend_events_insert_input!) {
+				insert_friends_one(object: $object) {
+					id
+				}
+				insert_friend_events_one(object: $event) {
+					id
+				}
+			}
+		`
+		changes["user_id"] = firstID
+		changes["friend_id"] = secondID
+		requestBody := map[string]interface{}{
+			"query": mutation,
+			"variables": map[string]interface{}{
+				"object": changes,
+				"event":  event,
+			},
+		}
+		if err := hasura.Request(requestBody, nil); errors.Is(err, hasura.ErrConstraint) {
+			return "", ErrFriendConflict
+		} else if err != nil {
+			return "", fmt.Errorf("failed to insert friend request: %w", err)
+		}
+		return status, nil
+	}
+	mutation := `
+		mutation UpdateFriendStatus($id: bigint!, $previousStatus: String!, $changes: friends_set_input!, $event: friend_events_insert_input!) {
+			update_friends(where: {id: {_eq: $id}, status: {_eq: $previousStatus}}, _set: $changes) {
+				affected_rows
+			}
+			insert_friend_events_one(object: $event) {
+				id
+			}
+		}
+	`
+	variables := map[string]interface{}{
+		"id":             friendship.ID,
+		"previousStatus": friendship.Status,
+		"changes":        changes,
+		"event":          event,
+	}
+	if noteOnly {
+		mutation = `
+			mutation UpdateFriendNote($id: bigint!, $previousStatus: String!, $changes: friends_set_input!) {
+				update_friends(where: {id: {_eq: $id}, status: {_eq: $previousStatus}}, _set: $changes) {
+					affected_rows
+				}
+			}
+		`
+		delete(variables, "event")
+	}
+	requestBody := map[string]interface{}{
+		"query":     mutation,
+		"variables": variables,
+	}
+	var responseData struct {
+		UpdateFriends struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_friends"`
+		InsertFriendEventsOne *struct {
+			ID interface{} `json:"id"`
+		} `json:"insert_friend_events_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to update friend status: %w", err)
+	}
+	if responseData.UpdateFriends.AffectedRows == 0 {
+		if responseData.InsertFriendEventsOne != nil {
+			if err := deleteEvent(responseData.InsertFriendEventsOne.ID); err != nil {
+				log.Printf("Error removing friend event for a conflicting update: %s", err)
+			}
+		}
+		return "", ErrFriendConflict
+	}
+	return status, nil
+}
+func deleteEvent(eventID interface{}) error {
+	mutation := `
+		mutation DeleteFriendEvent($id: bigint!) {
+			delete_friend_events_by_pk(id: $id) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"id": eventID,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to delete friend event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package friends
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransitionCrossRequestAccepts(t *testing.T) {
+	now := time.Now()
+	friendship := &Friendship{
+		Status:      StatusRequested,
+		ToAccept:    "user_b",
+		RequestedAt: now.Format(time.RFC3339Nano),
+	}
+	status, err := Transition(friendship, "user_b", OperationRequest, now)
+	if err != nil || status != StatusAccepted {
+		t.Fatalf("expected %s, got %s (%v)", StatusAccepted, status, err)
+	}
+	if _, err := Transition(friendship, "user_a", OperationRequest, now); err != ErrFriendRequestSent {
+		t.Fatalf("expected ErrFriendRequestSent, got %v", err)
+	}
+}
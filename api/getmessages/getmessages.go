@@ -26,6 +26,7 @@ type Message struct {
 	EncryptedContent string `json:"encrypted_content"`
 	CreatedAt        string `json:"created_at"`
 	Key              string `json:"key"`
+	System           bool   `json:"system"`
 }
 
 func DecryptMessage(encryptedContent, ivHex string, key []byte) (string, error) {
@@ -280,6 +281,7 @@ func GetMessages(senderID, recipientID string) ([]Message, error) {
 				encrypted_content
 				created_at
 				key
+				system
 			}
 		}
 	`
@@ -0,0 +1,334 @@
+package getoverlap
+
+import (
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	DefaultDays = 7
+	MaxDays     = 28
+	MaxWindows  = 50
+)
+
+type AvailabilityWindow struct {
+	Day   int    `json:"day"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type Schedule struct {
+	Timezone     string               `json:"timezone"`
+	Availability []AvailabilityWindow `json:"availability"`
+}
+
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type OverlapResponse struct {
+	FriendID   string  `json:"friend_id"`
+	Slots      []Slot  `json:"slots"`
+	TotalHours float64 `json:"total_hours"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to get availability overlap from Hasura")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	friendID := query.Get("friend_id")
+	if userID == "" || friendID == "" {
+		http.Error(w, "Missing user_id or friend_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	days := DefaultDays
+	if d := query.Get("days"); d != "" {
+		parsedDays, err := strconv.Atoi(d)
+		if err != nil || parsedDays < 1 {
+			http.Error(w, "Invalid days query parameter, expected a positive integer", http.StatusBadRequest)
+			return
+		}
+		if parsedDays > MaxDays {
+			parsedDays = MaxDays
+		}
+		days = parsedDays
+	}
+	updateseen.UpdateUserInHasura(userID)
+	areFriends, err := CheckFriendship(userID, friendID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check friendship: %s", err), http.StatusInternalServerError)
+		log.Printf("Error checking friendship: %s", err)
+		return
+	}
+	if !areFriends {
+		http.Error(w, "Overlap is only available between friends", http.StatusForbidden)
+		log.Printf("Users %s and %s are not friends", userID, friendID)
+		return
+	}
+	schedules, err := GetSchedules([]string{userID, friendID})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get schedules from Hasura: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting schedules from Hasura: %s", err)
+		return
+	}
+	from := time.Now().UTC().Truncate(time.Minute)
+	slots := OverlapSlots(schedules[userID], schedules[friendID], from, days)
+	response := OverlapResponse{
+		FriendID:   friendID,
+		Slots:      slots,
+		TotalHours: TotalHours(slots),
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Availability overlap successfully calculated")
+}
+func ValidateSchedule(schedule Schedule) error {
+	if schedule.Timezone == "" {
+		if len(schedule.Availability) > 0 {
+			return fmt.Errorf("timezone is required when availability is set")
+		}
+		return nil
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+	if len(schedule.Availability) > MaxWindows {
+		return fmt.Errorf("at most %d availability windows are allowed", MaxWindows)
+	}
+	for _, window := range schedule.Availability {
+		if window.Day < 0 || window.Day > 6 {
+			return fmt.Errorf("invalid day %d, expected 0 (Sunday) to 6 (Saturday)", window.Day)
+		}
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			return fmt.Errorf("availability window %s-%s must end after it starts", window.Start, window.End)
+		}
+	}
+	return nil
+}
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || hours < 0 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return hours*60 + minutes, nil
+}
+func ExpandSchedule(schedule Schedule, from time.Time, days int) []Slot {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if schedule.Timezone == "" || err != nil {
+		return nil
+	}
+	until := from.Add(time.Duration(days) * 24 * time.Hour)
+	local := from.In(loc)
+	slots := []Slot{}
+	for d := -1; d <= days; d++ {
+		date := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, loc)
+		for _, window := range schedule.Availability {
+			if time.Weekday(window.Day) != date.Weekday() {
+				continue
+			}
+			startMinutes, err := parseClock(window.Start)
+			if err != nil {
+				continue
+			}
+			endMinutes, err := parseClock(window.End)
+			if err != nil || startMinutes >= endMinutes {
+				continue
+			}
+			start := time.Date(date.Year(), date.Month(), date.Day(), 0, startMinutes, 0, 0, loc).UTC()
+			end := time.Date(date.Year(), date.Month(), date.Day(), 0, endMinutes, 0, 0, loc).UTC()
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(until) {
+				end = until
+			}
+			if start.Before(end) {
+				slots = append(slots, Slot{Start: start, End: end})
+			}
+		}
+	}
+	return mergeSlots(slots)
+}
+func mergeSlots(slots []Slot) []Slot {
+	if len(slots) == 0 {
+		return slots
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+	merged := []Slot{slots[0]}
+	for _, slot := range slots[1:] {
+		last := &merged[len(merged)-1]
+		if !slot.Start.After(last.End) {
+			if slot.End.After(last.End) {
+				last.End = slot.End
+			}
+			continue
+		}
+		merged = append(merged, slot)
+	}
+	return merged
+}
+func OverlapSlots(a, b Schedule, from time.Time, days int) []Slot {
+	slotsA := ExpandSchedule(a, from, days)
+	slotsB := ExpandSchedule(b, from, days)
+	overlap := []Slot{}
+	i, j := 0, 0
+	for i < len(slotsA) && j < len(slotsB) {
+		start := slotsA[i].Start
+		if slotsB[j].Start.After(start) {
+			start = slotsB[j].Start
+		}
+		end := slotsA[i].End
+		if slotsB[j].End.Before(end) {
+			end = slotsB[j].End
+		}
+		if start.Before(end) {
+			overlap = append(overlap, Slot{Start: start, End: end})
+		}
+		if slotsA[i].End.Before(slotsB[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return overlap
+}
+func TotalHours(slots []Slot) float64 {
+	total := time.Duration(0)
+	for _, slot := range slots {
+		total += slot.End.Sub(slot.Start)
+	}
+	return total.Hours()
+}
+func CheckFriendship(userID, friendID string) (bool, error) {
+	firstID, secondID := userID, friendID
+	if userID > friendID {
+		firstID, secondID = friendID, userID
+	}
+	query := `
+		query CheckFriendship($first_id: String!, $second_id: String!){
+			friends(where: {
+				user_id: {_eq: $first_id},
+				friend_id: {_eq: $second_id},
+				status: {_eq: "accepted"}
+			}){
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"first_id":  firstID,
+			"second_id": secondID,
+		},
+	}
+	var responseData struct {
+		Friends []struct {
+			ID interface{} `json:"id"`
+		} `json:"friends"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, fmt.Errorf("failed to check friendship: %w", err)
+	}
+	return len(responseData.Friends) > 0, nil
+}
+func GetSchedules(userIDs []string) (map[string]Schedule, error) {
+	schedules := make(map[string]Schedule, len(userIDs))
+	if len(userIDs) == 0 {
+		return schedules, nil
+	}
+	query := `
+		query GetSchedules($userIDs: [String!]!) {
+			users(where: {id: {_in: $userIDs}}) {
+				id
+				timezone
+				availability
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userIDs": userIDs,
+		},
+	}
+	var responseData struct {
+		Users []struct {
+			ID           string               `json:"id"`
+			Timezone     *string              `json:"timezone"`
+			Availability []AvailabilityWindow `json:"availability"`
+		} `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
+	}
+	for _, u := range responseData.Users {
+		schedule := Schedule{Availability: u.Availability}
+		if u.Timezone != nil {
+			schedule.Timezone = *u.Timezone
+		}
+		schedules[u.ID] = schedule
+	}
+	return schedules, nil
+}
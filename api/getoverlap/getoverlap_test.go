@@ -0,0 +1,89 @@
+package getoverlap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandScheduleDST(t *testing.T) {
+	schedule := Schedule{
+		Timezone:     "America/New_York",
+		Availability: []AvailabilityWindow{{Day: 0, Start: "00:00", End: "03:00"}},
+	}
+	cases := []struct {
+		name      string
+		from      string
+		wantStart string
+		wantEnd   string
+	}{
+		{"standard time", "2026-03-01T00:00:00Z", "2026-03-01T05:00:00Z", "2026-03-01T08:00:00Z"},
+		{"spring forward", "2026-03-08T00:00:00Z", "2026-03-08T05:00:00Z", "2026-03-08T07:00:00Z"},
+		{"daylight time", "2026-03-15T00:00:00Z", "2026-03-15T04:00:00Z", "2026-03-15T07:00:00Z"},
+		{"fall back", "2026-11-01T00:00:00Z", "2026-11-01T04:00:00Z", "2026-11-01T08:00:00Z"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			from, _ := time.Parse(time.RFC3339, c.from)
+			slots := ExpandSchedule(schedule, from, 1)
+			if len(slots) != 1 {
+				t.Fatalf("ExpandSchedule() = %v, want one slot", slots)
+			}
+			if got := slots[0].Start.Format(time.RFC3339); got != c.wantStart {
+				t.Errorf("start = %s, want %s", got, c.wantStart)
+			}
+			if got := slots[0].End.Format(time.RFC3339); got != c.wantEnd {
+				t.Errorf("end = %s, want %s", got, c.wantEnd)
+			}
+		})
+	}
+}
+func TestOverlapSlotsAcrossDSTChanges(t *testing.T) {
+	newYork := Schedule{
+		Timezone:     "America/New_York",
+		Availability: []AvailabilityWindow{{Day: 1, Start: "09:00", End: "17:00"}},
+	}
+	london := Schedule{
+		Timezone:     "Europe/London",
+		Availability: []AvailabilityWindow{{Day: 1, Start: "09:00", End: "17:00"}},
+	}
+	cases := []struct {
+		name string
+		from string
+		want float64
+	}{
+		{"both standard", "2026-03-02T00:00:00Z", 3},
+		{"only New York on daylight time", "2026-03-09T00:00:00Z", 4},
+		{"both daylight", "2026-03-30T00:00:00Z", 3},
+		{"only London back on standard time", "2026-10-26T00:00:00Z", 4},
+		{"both standard again", "2026-11-02T00:00:00Z", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			from, _ := time.Parse(time.RFC3339, c.from)
+			if got := TotalHours(OverlapSlots(newYork, london, from, 1)); got != c.want {
+				t.Errorf("TotalHours() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+func TestValidateSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{"empty", Schedule{}, false},
+		{"availability without timezone", Schedule{Availability: []AvailabilityWindow{{Day: 1, Start: "09:00", End: "17:00"}}}, true},
+		{"unknown timezone", Schedule{Timezone: "Mars/Olympus_Mons"}, true},
+		{"valid", Schedule{Timezone: "Europe/London", Availability: []AvailabilityWindow{{Day: 1, Start: "09:00", End: "24:00"}}}, false},
+		{"ends before start", Schedule{Timezone: "Europe/London", Availability: []AvailabilityWindow{{Day: 1, Start: "17:00", End: "09:00"}}}, true},
+		{"invalid day", Schedule{Timezone: "Europe/London", Availability: []AvailabilityWindow{{Day: 7, Start: "09:00", End: "17:00"}}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := ValidateSchedule(c.schedule); (err != nil) != c.wantErr {
+				t.Errorf("ValidateSchedule() error = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
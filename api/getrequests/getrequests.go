@@ -1,6 +1,9 @@
 package getrequests
 
 import (
+	"api/addfriend"
+	"api/friends"
+	"api/getusers"
 	"api/updateseen"
 	"bytes"
 	"encoding/json"
@@ -8,6 +11,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
 )
 
 type User struct {
@@ -21,10 +30,35 @@ type User struct {
 	Interests      []string `json:"interests"`
 	Occupation     string   `json:"occupation"`
 	LastSeen       string   `json:"last_seen"`
+	Note           string   `json:"note,omitempty"`
+	SharedLanguage []string `json:"shared_language,omitempty"`
+	SharedInterest []string `json:"shared_interests,omitempty"`
+}
+
+type FriendNotification struct {
+	addfriend.FriendNotification
+	Actor *User `json:"actor"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Received request to get friends from Hasura")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
 
 	query := r.URL.Query()
 	userID := query.Get("user_id")
@@ -34,12 +68,45 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing one or more query parameters", http.StatusBadRequest)
 		return
 	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	limit, err := getusers.ParsePageSize(query.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor, err := getusers.DecodeCursor(query.Get("cursor"))
+	if err != nil || cursor.Score != nil {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		log.Printf("Error decoding cursor: %v", err)
+		return
+	}
+	if kind == "friend_notifications" {
+		page, err := GetFriendNotificationsPage(userID, cursor, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get friend notifications from Hasura: %s", err), http.StatusInternalServerError)
+			log.Printf("Error getting friend notifications from Hasura: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+			log.Printf("Error creating response JSON: %s", err)
+			return
+		}
+		log.Printf("Friend notifications successfully retrieved from Hasura")
+		return
+	}
 	friendLists := []string(nil)
-	err := error(nil)
+	requestNotes := map[string]string{}
 	if kind == "friend" {
 		friendLists, err = GetFriendLists(userID)
 	} else if kind == "request" {
-		friendLists, err = GetRequestLists(userID)
+		friendLists, requestNotes, err = GetRequestLists(userID)
 	} else if kind == "notifications" {
 		friendLists, err = GetNotifications(userID)
 	} else {
@@ -51,10 +118,12 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error getting friends from Hasura: %s", err)
 		return
 	}
+	pageIDs, nextCursor, prevCursor := getusers.PageIDs(friendLists, cursor, limit)
+	page := getusers.Page{Data: pageIDs, NextCursor: nextCursor, PrevCursor: prevCursor}
 	if kind == "notifications" {
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(friendLists); err != nil {
+		if err := json.NewEncoder(w).Encode(page); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
 			log.Printf("Error creating response JSON: %s", err)
 			return
@@ -63,16 +132,24 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	updateseen.UpdateUserInHasura(userID)
-	users, err := GetUsersInfo(friendLists)
+	users, err := GetUsersInfo(pageIDs)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get users info from Hasura: %s", err), http.StatusInternalServerError)
 		log.Printf("Error getting users info from Hasura: %s", err)
 		return
 	}
+	if kind == "request" {
+		if err := AddRequestContext(userID, users, requestNotes); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get request context from Hasura: %s", err), http.StatusInternalServerError)
+			log.Printf("Error getting request context from Hasura: %s", err)
+			return
+		}
+	}
+	page.Data = users
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(users); err != nil {
+	if err := json.NewEncoder(w).Encode(page); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
 		log.Printf("Error creating response JSON: %s", err)
 		return
@@ -147,26 +224,29 @@ func GetFriendLists(userID string) ([]string, error) {
 	}
 	return friendList, nil
 }
-func GetRequestLists(userID string) ([]string, error) {
+func GetRequestLists(userID string) ([]string, map[string]string, error) {
 	query := `
-		query GetFriends($userID: String!) {
-			friends1: friends(where: {user_id: {_eq: $userID}, status: {_eq: "pending"}, to_accept: {_eq: $userID}}) {
+		query GetFriends($userID: String!, $requestedAfter: timestamptz!) {
+			friends1: friends(where: {user_id: {_eq: $userID}, status: {_eq: "requested"}, to_accept: {_eq: $userID}, requested_at: {_gte: $requestedAfter}}) {
 				friend_id
+				note
 			}
-			friends2: friends(where: {friend_id: {_eq: $userID}, status: {_eq: "pending"}, to_accept: {_eq: $userID}}) {
+			friends2: friends(where: {friend_id: {_eq: $userID}, status: {_eq: "requested"}, to_accept: {_eq: $userID}, requested_at: {_gte: $requestedAfter}}) {
 				user_id
+				note
 			}
 		}
 	`
 	requestBody := map[string]interface{}{
 		"query": query,
 		"variables": map[string]interface{}{
-			"userID": userID,
+			"userID":         userID,
+			"requestedAfter": time.Now().Add(-friends.RequestExpiry()).Format(time.RFC3339Nano),
 		},
 	}
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request body: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request body: %w", err)
 	}
 
 	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
@@ -174,7 +254,7 @@ func GetRequestLists(userID string) ([]string, error) {
 
 	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
@@ -182,38 +262,47 @@ func GetRequestLists(userID string) ([]string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request to Hasura: %w", err)
+		return nil, nil, fmt.Errorf("failed to send request to Hasura: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 	var responseBody struct {
 		Data struct {
 			Friends1 []struct {
-				FriendID string `json:"friend_id"`
+				FriendID string  `json:"friend_id"`
+				Note     *string `json:"note"`
 			} `json:"friends1"`
 			Friends2 []struct {
-				UserID string `json:"user_id"`
+				UserID string  `json:"user_id"`
+				Note   *string `json:"note"`
 			} `json:"friends2"`
 		} `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return nil, fmt.Errorf("failed to decode response body: %w", err)
+		return nil, nil, fmt.Errorf("failed to decode response body: %w", err)
 	}
 	friendList := []string{}
+	notes := make(map[string]string)
 	for _, friend := range responseBody.Data.Friends1 {
 		if friend.FriendID != userID {
 			friendList = append(friendList, friend.FriendID)
+			if friend.Note != nil {
+				notes[friend.FriendID] = *friend.Note
+			}
 		}
 	}
 	for _, friend := range responseBody.Data.Friends2 {
 		if friend.UserID != userID {
 			friendList = append(friendList, friend.UserID)
+			if friend.Note != nil {
+				notes[friend.UserID] = *friend.Note
+			}
 		}
 	}
-	return friendList, nil
+	return friendList, notes, nil
 }
 func GetNotifications(userID string) ([]string, error) {
 	query := `
@@ -273,13 +362,75 @@ func GetNotifications(userID string) ([]string, error) {
 
 	return fromUsers, nil
 }
+func GetFriendNotificationsPage(userID string, cursor getusers.Cursor, limit int) (getusers.Page, error) {
+	notifications, err := addfriend.GetFriendNotifications(userID)
+	if err != nil {
+		return getusers.Page{}, err
+	}
+	byKey := make(map[string]addfriend.FriendNotification, len(notifications))
+	keys := make([]string, len(notifications))
+	for i, notification := range notifications {
+		keys[i] = fmt.Sprintf("%s|%v", notification.CreatedAt, notification.ID)
+		byKey[keys[i]] = notification
+	}
+	pageKeys, nextCursor, prevCursor := getusers.PageIDs(keys, cursor, limit)
+	actorIDs := []string{}
+	for _, key := range pageKeys {
+		actorIDs = append(actorIDs, byKey[key].ActorID)
+	}
+	actors, err := GetUsersInfo(actorIDs)
+	if err != nil {
+		return getusers.Page{}, err
+	}
+	actorsByID := make(map[string]*User, len(actors))
+	for i := range actors {
+		actorsByID[actors[i].ID] = &actors[i]
+	}
+	data := make([]FriendNotification, len(pageKeys))
+	for i, key := range pageKeys {
+		data[i] = FriendNotification{FriendNotification: byKey[key], Actor: actorsByID[byKey[key].ActorID]}
+	}
+	return getusers.Page{Data: data, NextCursor: nextCursor, PrevCursor: prevCursor}, nil
+}
+func AddRequestContext(userID string, requesters []User, notes map[string]string) error {
+	if len(requesters) == 0 {
+		return nil
+	}
+	users, err := GetUsersInfo([]string{userID})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("user %s not found", userID)
+	}
+	for i := range requesters {
+		requesters[i].Note = notes[requesters[i].ID]
+		requesters[i].SharedLanguage = SharedValues(users[0].Language, requesters[i].Language)
+		requesters[i].SharedInterest = SharedValues(users[0].Interests, requesters[i].Interests)
+	}
+	return nil
+}
+func SharedValues(a, b []string) []string {
+	inA := make(map[string]bool, len(a))
+	for _, value := range a {
+		inA[strings.ToLower(value)] = true
+	}
+	shared := []string{}
+	for _, value := range b {
+		if inA[strings.ToLower(value)] {
+			shared = append(shared, value)
+			delete(inA, strings.ToLower(value))
+		}
+	}
+	return shared
+}
 func GetUsersInfo(userIDs []string) ([]User, error) {
 	if len(userIDs) == 0 {
 		return []User{}, nil
 	}
 	query := `
 		query GetUsersInfo($userIDs: [String!]!) {
-			users(where: {id: {_in: $userIDs}}) {
+			users(where: {id: {_in: $userIDs}}, order_by: {id: asc}) {
 				id
 				name
 				email
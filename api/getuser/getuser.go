@@ -1,6 +1,7 @@
 package getuser
 
 import (
+	"api/updateuser"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -15,14 +16,17 @@ type GetUserRequest struct {
 }
 
 type User struct {
-	ID             string   `json:"id"`
-	Name           string   `json:"name"`
-	Bio            string   `json:"bio"`
-	Language       []string `json:"language"`
-	Specialty      string   `json:"specialty"`
-	Interests      []string `json:"interests"`
-	Occupation     string   `json:"occupation"`
-	ProfilePicture string   `json:"profile_picture"`
+	ID             string                     `json:"id"`
+	Name           string                     `json:"name"`
+	Bio            string                     `json:"bio"`
+	Language       []string                   `json:"language"`
+	Specialty      string                     `json:"specialty"`
+	Interests      []string                   `json:"interests"`
+	Occupation     string                     `json:"occupation"`
+	ProfilePicture string                     `json:"profile_picture"`
+	Proficiency    []updateuser.LanguageSkill `json:"proficiency"`
+	PeerLevel      string                     `json:"peer_level"`
+	CoffeeChat     bool                       `json:"coffee_chat_opt_in"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +70,9 @@ func GetUserFromHasura(userID, userEmail string) (*User, error) {
 					interests
 					occupation
 					profile_picture
+					proficiency
+					peer_level
+					coffee_chat_opt_in
 				}
 			}
 		`
@@ -123,6 +130,9 @@ func GetUserFromHasura(userID, userEmail string) (*User, error) {
 					interests
 					occupation
 					profile_picture
+					proficiency
+					peer_level
+					coffee_chat_opt_in
 				}
 			}
 		`
@@ -1,70 +1,715 @@
 package getusers
 
 import (
+	"api/addfriend"
+	"api/blockuser"
+	"api/friends"
+	"api/getoverlap"
+	"api/hasura"
+	"api/onboarding"
+	"api/resolvecity"
 	"api/updateseen"
-	"bytes"
+	"api/updateuser"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	DefaultPageSize         = 10
+	MaxPageSize             = 50
+	DefaultPassCooldownDays = 30
+	OverlapBoostPerHour     = 0.5
+	MaxBoostedOverlapHours  = 10
+	SkillBoostWeight        = 1.0
+	MutualFriendWeight      = 2
+	MaxBoostedMutualFriends = 5
+	DistanceBoostWeight     = 2.0
+	MaxBoostedDistanceKm    = 100.0
+	CandidatePoolSize       = 200
 )
 
+var ErrNoLocation = errors.New("user has no location set")
+
 type User struct {
-	Name           string   `json:"name"`
-	Email          string   `json:"email"`
-	ProfilePicture string   `json:"profile_picture"`
-	Bio            string   `json:"bio"`
-	Language       []string `json:"language"`
-	Specialty      string   `json:"specialty"`
-	Interests      []string `json:"interests"`
-	Occupation     string   `json:"occupation"`
+	ID                string                     `json:"id"`
+	Name              string                     `json:"name"`
+	Email             string                     `json:"email"`
+	ProfilePicture    string                     `json:"profile_picture"`
+	Bio               string                     `json:"bio"`
+	Language          []string                   `json:"language"`
+	Specialty         string                     `json:"specialty"`
+	Interests         []string                   `json:"interests"`
+	Occupation        string                     `json:"occupation"`
+	SimilarityScore   int64                      `json:"similarity_score"`
+	Proficiency       []updateuser.LanguageSkill `json:"proficiency"`
+	OverlapHours      float64                    `json:"overlap_hours"`
+	MatchScore        float64                    `json:"match_score"`
+	MutualFriendCount int                        `json:"mutual_friend_count"`
+	MutualFriends     []string                   `json:"mutual_friends"`
+	Distance          string                     `json:"distance,omitempty"`
+}
+
+type Cursor struct {
+	Score     *float64 `json:"score,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	After     string   `json:"after,omitempty"`
+	Before    string   `json:"before,omitempty"`
+}
+
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Received request to get user from Hasura")
-	offset := 0
-	limit := 10
 	userID := ""
 	query := r.URL.Query()
-	if o := query.Get("offset"); o != "" {
-		if parsedOffset, err := strconv.Atoi(o); err == nil {
-			offset = parsedOffset
-		}
+	limit, err := ParsePageSize(query.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if l := query.Get("limit"); l != "" {
-		if parsedLimit, err := strconv.Atoi(l); err == nil {
-			limit = parsedLimit
-		}
+	cursor, err := DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		log.Printf("Error decoding cursor: %s", err)
+		return
+	}
+	if (cursor.After != "" || cursor.Before != "") && cursor.Score == nil {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		log.Printf("Cursor is missing a match score")
+		return
 	}
 	if u := query.Get("user_id"); u != "" {
+		clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+		sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+			Token: sessionToken,
+		})
+		if err != nil {
+			http.Error(w, "Session not found", http.StatusUnauthorized)
+			log.Printf("Session not found")
+			return
+		}
+		usr, err := user.Get(r.Context(), claims.Subject)
+		if err != nil {
+			http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+			log.Printf("User could not be retrieved from session")
+			return
+		}
+		if u != usr.ID {
+			http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, u)
+			return
+		}
 		userID = u
 		updateseen.UpdateUserInHasura(userID)
 	}
-	users, err := GetUsersFromHasura(offset, limit, userID)
+	if mode := query.Get("mode"); mode == "mentor" || mode == "mutual" {
+		if userID == "" {
+			http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+			return
+		}
+		var page *Page
+		if mode == "mentor" {
+			page, err = GetMentorMatches(userID, cursor, limit)
+		} else {
+			page, err = GetPeopleYouMayKnow(userID, cursor, limit)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get %s matches from Hasura: %s", mode, err), http.StatusInternalServerError)
+			log.Printf("Error getting %s matches from Hasura: %s", mode, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+			log.Printf("Error creating response JSON: %s", err)
+			return
+		}
+		log.Printf("%s matches successfully retrieved from Hasura", mode)
+		return
+	} else if mode != "" && mode != "peer" {
+		http.Error(w, "Invalid mode query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != "" && query.Get("max_distance_km") == "" {
+		onboarded, _, err := onboarding.GetOnboardingStatus(userID)
+		if err != nil {
+			log.Printf("Error getting onboarding status: %s", err)
+		} else if !onboarded {
+			page, err := GetPopularUsers(userID, cursor, limit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get popular users from Hasura: %s", err), http.StatusInternalServerError)
+				log.Printf("Error getting popular users from Hasura: %s", err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(page); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+				log.Printf("Error creating response JSON: %s", err)
+				return
+			}
+			log.Printf("Popular users successfully retrieved from Hasura for user who has not onboarded")
+			return
+		}
+	}
+	maxDistanceKm := 0.0
+	if d := query.Get("max_distance_km"); d != "" {
+		maxDistanceKm, err = strconv.ParseFloat(d, 64)
+		if err != nil || maxDistanceKm <= 0 || userID == "" {
+			http.Error(w, "Invalid max_distance_km query parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	users, err := GetUsersFromHasura(CandidatePoolSize, userID, maxDistanceKm)
+	if errors.Is(err, ErrNoLocation) {
+		http.Error(w, "Set a city on your profile to filter by distance", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get user from Hasura: %s", err), http.StatusInternalServerError)
 		log.Printf("Error getting user from Hasura: %s", err)
 		return
 	}
+	if err := ApplyBoosts(userID, users); err != nil {
+		log.Printf("Error applying recommendation boosts: %s", err)
+	}
+	page := PageUsers(users, cursor, limit)
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(users); err != nil {
+	if err := json.NewEncoder(w).Encode(page); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
 		log.Printf("Error creating response JSON: %s", err)
 		return
 	}
 	log.Printf("Users successfully retrieved from Hasura")
 }
+func ApplyBoosts(userID string, users []User) error {
+	for i := range users {
+		users[i].MatchScore = float64(users[i].SimilarityScore)
+	}
+	if userID == "" || len(users) == 0 {
+		return nil
+	}
+	userIDs := []string{userID}
+	for _, u := range users {
+		userIDs = append(userIDs, u.ID)
+	}
+	schedules, err := getoverlap.GetSchedules(userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get schedules: %w", err)
+	}
+	skillProfiles, err := updateuser.GetSkillProfiles(userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get skill profiles: %w", err)
+	}
+	mutualFriends, err := GetMutualFriends(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get mutual friends: %w", err)
+	}
+	locations, err := resolvecity.GetLocations(userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get locations: %w", err)
+	}
+	origin, hasOrigin := locations[userID]
+	from := WeekStart(time.Now())
+	for i, u := range users {
+		if location, ok := locations[u.ID]; ok && hasOrigin {
+			distanceKm := resolvecity.DistanceKm(origin.Latitude, origin.Longitude, location.Latitude, location.Longitude)
+			users[i].Distance = resolvecity.Bucket(distanceKm)
+			users[i].MatchScore += max(0, 1-distanceKm/MaxBoostedDistanceKm) * DistanceBoostWeight
+		}
+		users[i].MutualFriends = mutualFriends[u.ID]
+		users[i].MutualFriendCount = len(mutualFriends[u.ID])
+		users[i].MatchScore += float64(min(users[i].MutualFriendCount, MaxBoostedMutualFriends)) * MutualFriendWeight
+		overlapHours := getoverlap.TotalHours(getoverlap.OverlapSlots(schedules[userID], schedules[u.ID], from, getoverlap.DefaultDays))
+		users[i].OverlapHours = overlapHours
+		if overlapHours > MaxBoostedOverlapHours {
+			overlapHours = MaxBoostedOverlapHours
+		}
+		users[i].MatchScore += overlapHours * OverlapBoostPerHour
+		users[i].Proficiency = skillProfiles[u.ID].Proficiency
+		users[i].MatchScore += updateuser.SkillMatchScore(skillProfiles[userID], skillProfiles[u.ID]) * SkillBoostWeight
+	}
+	return nil
+}
+func WeekStart(now time.Time) time.Time {
+	now = now.UTC()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	return time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+func ParsePageSize(limit string) (int, error) {
+	if limit == "" {
+		return DefaultPageSize, nil
+	}
+	parsedLimit, err := strconv.Atoi(limit)
+	if err != nil || parsedLimit < 1 {
+		return 0, fmt.Errorf("invalid limit query parameter, expected a positive integer")
+	}
+	if parsedLimit > MaxPageSize {
+		return MaxPageSize, nil
+	}
+	return parsedLimit, nil
+}
+func EncodeCursor(cursor Cursor) string {
+	jsonCursor, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+func DecodeCursor(token string) (Cursor, error) {
+	var cursor Cursor
+	if token == "" {
+		return cursor, nil
+	}
+	jsonCursor, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("failed to decode cursor: %w", err)
+	}
+	if err := json.Unmarshal(jsonCursor, &cursor); err != nil {
+		return cursor, fmt.Errorf("failed to parse cursor: %w", err)
+	}
+	if cursor.After != "" && cursor.Before != "" {
+		return cursor, fmt.Errorf("malformed cursor")
+	}
+	return cursor, nil
+}
+func PageIDs(ids []string, cursor Cursor, limit int) ([]string, string, string) {
+	seen := make(map[string]bool, len(ids))
+	sorted := []string{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			sorted = append(sorted, id)
+		}
+	}
+	sort.Strings(sorted)
+	start, end := 0, len(sorted)
+	if cursor.Before != "" {
+		end = sort.SearchStrings(sorted, cursor.Before)
+		start = end - limit
+		if start < 0 {
+			start = 0
+		}
+	} else {
+		if cursor.After != "" {
+			start = sort.SearchStrings(sorted, cursor.After)
+			if start < len(sorted) && sorted[start] == cursor.After {
+				start++
+			}
+		}
+		if start+limit < end {
+			end = start + limit
+		}
+	}
+	page := sorted[start:end]
+	nextCursor, prevCursor := "", ""
+	if len(page) == 0 {
+		return page, nextCursor, prevCursor
+	}
+	if end < len(sorted) {
+		nextCursor = EncodeCursor(Cursor{After: page[len(page)-1]})
+	}
+	if start > 0 {
+		prevCursor = EncodeCursor(Cursor{Before: page[0]})
+	}
+	return page, nextCursor, prevCursor
+}
+func PageUsers(users []User, cursor Cursor, limit int) Page {
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].MatchScore != users[j].MatchScore {
+			return users[i].MatchScore > users[j].MatchScore
+		}
+		return users[i].ID < users[j].ID
+	})
+	comesBefore := func(u User, score float64, id string) bool {
+		return u.MatchScore > score || (u.MatchScore == score && u.ID < id)
+	}
+	start, end := 0, len(users)
+	if cursor.Before != "" && cursor.Score != nil {
+		end = sort.Search(len(users), func(i int) bool {
+			return !comesBefore(users[i], *cursor.Score, cursor.Before)
+		})
+		start = end - limit
+		if start < 0 {
+			start = 0
+		}
+	} else {
+		if cursor.After != "" && cursor.Score != nil {
+			start = sort.Search(len(users), func(i int) bool {
+				return !comesBefore(users[i], *cursor.Score, cursor.After) && !(users[i].MatchScore == *cursor.Score && users[i].ID == cursor.After)
+			})
+		}
+		if start+limit < end {
+			end = start + limit
+		}
+	}
+	pageUsers := users[start:end]
+	page := Page{Data: pageUsers}
+	if len(pageUsers) == 0 {
+		return page
+	}
+	first, last := pageUsers[0], pageUsers[len(pageUsers)-1]
+	if end < len(users) {
+		page.NextCursor = EncodeCursor(Cursor{Score: &last.MatchScore, After: last.ID})
+	}
+	if start > 0 {
+		page.PrevCursor = EncodeCursor(Cursor{Score: &first.MatchScore, Before: first.ID})
+	}
+	return page
+}
+func GetMentorMatches(userID string, cursor Cursor, limit int) (*Page, error) {
+	profiles, err := updateuser.GetSkillProfiles([]string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get skill profile: %w", err)
+	}
+	own := profiles[userID]
+	counterpartRole := ""
+	if own.Mentorship.Role == updateuser.MentorshipSeek {
+		counterpartRole = updateuser.MentorshipOffer
+	} else if own.Mentorship.Role == updateuser.MentorshipOffer {
+		counterpartRole = updateuser.MentorshipSeek
+	} else {
+		return nil, fmt.Errorf("user is not offering or seeking mentorship")
+	}
+	relatedIDs, err := addfriend.GetMentorshipLists(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentorship lists: %w", err)
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	relatedIDs = append(append(relatedIDs, blockedIDs...), userID)
+	query := `
+		query GetMentorshipCandidates($role: jsonb!, $relatedIDs: [String!]) {
+			users(where: {mentorship: {_contains: $role}, id: {_nin: $relatedIDs}, suspended: {_neq: true}}) {
+				id
+				name
+				email
+				bio
+				language
+				specialty
+				interests
+				occupation
+				profile_picture
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"role":       map[string]interface{}{"role": counterpartRole},
+			"relatedIDs": relatedIDs,
+		},
+	}
+	var responseData struct {
+		Users []User `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get mentorship candidates: %w", err)
+	}
+	candidateIDs := make([]string, len(responseData.Users))
+	for i, u := range responseData.Users {
+		candidateIDs[i] = u.ID
+	}
+	candidateProfiles, err := updateuser.GetSkillProfiles(candidateIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candidate skill profiles: %w", err)
+	}
+	matches := []User{}
+	for _, u := range responseData.Users {
+		candidate := candidateProfiles[u.ID]
+		score := int64(0)
+		if own.Mentorship.Role == updateuser.MentorshipSeek {
+			score = updateuser.MentorMatchScore(own, candidate)
+		} else {
+			score = updateuser.MentorMatchScore(candidate, own)
+		}
+		if score == 0 {
+			continue
+		}
+		u.SimilarityScore = score
+		u.MatchScore = float64(score)
+		u.Proficiency = candidate.Proficiency
+		matches = append(matches, u)
+	}
+	page := PageUsers(matches, cursor, limit)
+	return &page, nil
+}
+func GetMutualFriends(userID string) (map[string][]string, error) {
+	mutualFriends := make(map[string][]string)
+	if userID == "" {
+		return mutualFriends, nil
+	}
+	query := `
+		query GetAcceptedFriends($userID: String!) {
+			friends(where: {_or: [{user_id: {_eq: $userID}}, {friend_id: {_eq: $userID}}], status: {_eq: "accepted"}}) {
+				user_id
+				friend_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var friendsData struct {
+		Friends []struct {
+			UserID   string `json:"user_id"`
+			FriendID string `json:"friend_id"`
+		} `json:"friends"`
+	}
+	if err := hasura.Request(requestBody, &friendsData); err != nil {
+		return nil, fmt.Errorf("failed to get friends: %w", err)
+	}
+	friendIDs := []string{}
+	isFriend := make(map[string]bool)
+	for _, f := range friendsData.Friends {
+		friendID := f.FriendID
+		if friendID == userID {
+			friendID = f.UserID
+		}
+		friendIDs = append(friendIDs, friendID)
+		isFriend[friendID] = true
+	}
+	if len(friendIDs) == 0 {
+		return mutualFriends, nil
+	}
+	query = `
+		query GetFriendsOfFriends($friendIDs: [String!]!) {
+			friends(where: {_or: [{user_id: {_in: $friendIDs}}, {friend_id: {_in: $friendIDs}}], status: {_eq: "accepted"}}) {
+				user_id
+				friend_id
+			}
+			users(where: {id: {_in: $friendIDs}}) {
+				id
+				name
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"friendIDs": friendIDs,
+		},
+	}
+	var graphData struct {
+		Friends []struct {
+			UserID   string `json:"user_id"`
+			FriendID string `json:"friend_id"`
+		} `json:"friends"`
+		Users []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &graphData); err != nil {
+		return nil, fmt.Errorf("failed to get friends of friends: %w", err)
+	}
+	names := make(map[string]string, len(graphData.Users))
+	for _, u := range graphData.Users {
+		names[u.ID] = u.Name
+	}
+	addMutual := func(friendID, candidateID string) {
+		if isFriend[friendID] && candidateID != userID && !isFriend[candidateID] {
+			mutualFriends[candidateID] = append(mutualFriends[candidateID], names[friendID])
+		}
+	}
+	for _, f := range graphData.Friends {
+		addMutual(f.UserID, f.FriendID)
+		addMutual(f.FriendID, f.UserID)
+	}
+	for candidateID := range mutualFriends {
+		sort.Strings(mutualFriends[candidateID])
+	}
+	return mutualFriends, nil
+}
+func GetPeopleYouMayKnow(userID string, cursor Cursor, limit int) (*Page, error) {
+	mutualFriends, err := GetMutualFriends(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mutual friends: %w", err)
+	}
+	friendIDs, userIDs, err := GetFriendLists(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friend lists: %w", err)
+	}
+	hiddenIDs, err := GetHiddenIDs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hidden users: %w", err)
+	}
+	excluded := make(map[string]bool)
+	for _, ids := range [][]string{friendIDs, userIDs, hiddenIDs} {
+		for _, id := range ids {
+			excluded[id] = true
+		}
+	}
+	candidateIDs := []string{}
+	for candidateID := range mutualFriends {
+		if !excluded[candidateID] {
+			candidateIDs = append(candidateIDs, candidateID)
+		}
+	}
+	if len(candidateIDs) == 0 {
+		return &Page{Data: []User{}}, nil
+	}
+	query := `
+		mutation GetMutualCandidates($userID: String!, $candidateIDs: [String!]!) {
+			calculate_similarity_score(args: {user_id: $userID}, where: {id: {_in: $candidateIDs}}) {
+				id
+				name
+				email
+				bio
+				language
+				specialty
+				interests
+				occupation
+				profile_picture
+				similarity_score
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID":       userID,
+			"candidateIDs": candidateIDs,
+		},
+	}
+	var responseData struct {
+		Users []User `json:"calculate_similarity_score"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get mutual candidates: %w", err)
+	}
+	users := responseData.Users
+	for i, u := range users {
+		users[i].MutualFriends = mutualFriends[u.ID]
+		users[i].MutualFriendCount = len(mutualFriends[u.ID])
+		users[i].SimilarityScore += int64(min(users[i].MutualFriendCount, MaxBoostedMutualFriends)) * MutualFriendWeight
+		users[i].MatchScore = float64(users[i].SimilarityScore)
+	}
+	page := PageUsers(users, cursor, limit)
+	return &page, nil
+}
+func GetPopularUsers(userID string, cursor Cursor, limit int) (*Page, error) {
+	friendIDs, userIDs, err := GetFriendLists(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get friend lists: %w", err)
+	}
+	hiddenIDs, err := GetHiddenIDs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hidden users: %w", err)
+	}
+	excludedIDs := append(append(append([]string{userID}, friendIDs...), userIDs...), hiddenIDs...)
+	conditions := []map[string]interface{}{
+		{"id": map[string]interface{}{"_nin": excludedIDs}},
+	}
+	orderBy := []map[string]interface{}{
+		{"similarity_score": "desc"},
+		{"id": "asc"},
+	}
+	if cursor.After != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"_or": []map[string]interface{}{
+				{"similarity_score": map[string]interface{}{"_lt": *cursor.Score}},
+				{"similarity_score": map[string]interface{}{"_eq": *cursor.Score}, "id": map[string]interface{}{"_gt": cursor.After}},
+			},
+		})
+	} else if cursor.Before != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"_or": []map[string]interface{}{
+				{"similarity_score": map[string]interface{}{"_gt": *cursor.Score}},
+				{"similarity_score": map[string]interface{}{"_eq": *cursor.Score}, "id": map[string]interface{}{"_lt": cursor.Before}},
+			},
+		})
+		orderBy = []map[string]interface{}{
+			{"similarity_score": "asc"},
+			{"id": "desc"},
+		}
+	}
+	query := `
+		query GetPopularUsers($where: similarity_result_bool_exp!, $orderBy: [similarity_result_order_by!], $limit: Int!) {
+			popular_users(where: $where, order_by: $orderBy, limit: $limit) {
+				id
+				name
+				email
+				bio
+				language
+				specialty
+				interests
+				occupation
+				profile_picture
+				similarity_score
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where":   map[string]interface{}{"_and": conditions},
+			"orderBy": orderBy,
+			"limit":   limit + 1,
+		},
+	}
+	var responseData struct {
+		Users []User `json:"popular_users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get popular users: %w", err)
+	}
+	users := responseData.Users
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+	if cursor.Before != "" {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	for i := range users {
+		users[i].MatchScore = float64(users[i].SimilarityScore)
+	}
+	page := Page{Data: users}
+	if len(users) > 0 {
+		first, last := users[0], users[len(users)-1]
+		if hasMore || cursor.Before != "" {
+			page.NextCursor = EncodeCursor(Cursor{Score: &last.MatchScore, After: last.ID})
+		}
+		if (cursor.Before != "" && hasMore) || cursor.After != "" {
+			page.PrevCursor = EncodeCursor(Cursor{Score: &first.MatchScore, Before: first.ID})
+		}
+	}
+	return &page, nil
+}
 func GetFriendLists(userID string) ([]string, []string, error) {
 	query := `
-		query GetFriends($userID: String!) {
+		query GetFriends($userID: String!, $requestedAfter: timestamptz!, $declinedAfter: timestamptz!) {
 			friends1: friends(
 				where: {
 					_or: [
 						{user_id: {_eq: $userID}, status: {_eq: "accepted"}},
-						{user_id: {_eq: $userID}, status: {_eq: "pending"}, to_accept: {_neq: $userID}}
+						{user_id: {_eq: $userID}, status: {_eq: "requested"}, to_accept: {_neq: $userID}, requested_at: {_gte: $requestedAfter}},
+						{user_id: {_eq: $userID}, status: {_eq: "declined"}, to_accept: {_neq: $userID}, updated_at: {_gte: $declinedAfter}}
 					]	
 				}
 				) {
@@ -74,7 +719,8 @@ func GetFriendLists(userID string) ([]string, []string, error) {
 				where: {
 					_or: [
 						{friend_id: {_eq: $userID}, status: {_eq: "accepted"}},
-						{friend_id: {_eq: $userID}, status: {_eq: "pending"}, to_accept: {_neq: $userID}}
+						{friend_id: {_eq: $userID}, status: {_eq: "requested"}, to_accept: {_neq: $userID}, requested_at: {_gte: $requestedAfter}},
+						{friend_id: {_eq: $userID}, status: {_eq: "declined"}, to_accept: {_neq: $userID}, updated_at: {_gte: $declinedAfter}}
 					]	
 				}
 				) {
@@ -82,72 +728,122 @@ func GetFriendLists(userID string) ([]string, []string, error) {
 			}
 		}
 	`
+	now := time.Now()
 	requestBody := map[string]interface{}{
 		"query": query,
 		"variables": map[string]interface{}{
-			"userID": userID,
+			"userID":         userID,
+			"requestedAfter": now.Add(-friends.RequestExpiry()).Format(time.RFC3339Nano),
+			"declinedAfter":  now.Add(-friends.DeclineCooldown()).Format(time.RFC3339Nano),
 		},
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create request body: %w", err)
+	var responseData struct {
+		Friends1 []struct {
+			FriendID string `json:"friend_id"`
+		} `json:"friends1"`
+		Friends2 []struct {
+			UserID string `json:"user_id"`
+		} `json:"friends2"`
 	}
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to send request to Hasura: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, nil, fmt.Errorf("failed to get friend lists: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-	var responseBody struct {
-		Data struct {
-			Friends1 []struct {
-				FriendID string `json:"friend_id"`
-			} `json:"friends1"`
-			Friends2 []struct {
-				UserID string `json:"user_id"`
-			} `json:"friends2"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-	friendIDs := make([]string, len(responseBody.Data.Friends1))
-	for i, f := range responseBody.Data.Friends1 {
+	friendIDs := make([]string, len(responseData.Friends1))
+	for i, f := range responseData.Friends1 {
 		friendIDs[i] = f.FriendID
 	}
-	userIDs := make([]string, len(responseBody.Data.Friends2))
-	for i, f := range responseBody.Data.Friends2 {
+	userIDs := make([]string, len(responseData.Friends2))
+	for i, f := range responseData.Friends2 {
 		userIDs[i] = f.UserID
 	}
 	return friendIDs, userIDs, nil
 }
-func GetUsersFromHasura(offset, limit int, userID string) ([]User, error) {
+func PassCooldown() time.Duration {
+	days := DefaultPassCooldownDays
+	if d := os.Getenv("PASS_COOLDOWN_DAYS"); d != "" {
+		if parsedDays, err := strconv.Atoi(d); err == nil && parsedDays >= 0 {
+			days = parsedDays
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+func GetPassedIDs(userID string) ([]string, error) {
+	query := `
+		query GetPasses($userID: String!, $since: timestamptz!) {
+			passes(where: {user_id: {_eq: $userID}, created_at: {_gte: $since}}) {
+				passed_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+			"since":  time.Now().Add(-PassCooldown()).Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		Passes []struct {
+			PassedID string `json:"passed_id"`
+		} `json:"passes"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get passes: %w", err)
+	}
+	passedIDs := make([]string, len(responseData.Passes))
+	for i, p := range responseData.Passes {
+		passedIDs[i] = p.PassedID
+	}
+	return passedIDs, nil
+}
+func GetHiddenIDs(userID string) ([]string, error) {
+	passedIDs, err := GetPassedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(passedIDs, blockedIDs...), nil
+}
+func GetUsersFromHasura(limit int, userID string, maxDistanceKm float64) ([]User, error) {
 	friendIDs, userIDs, err := GetFriendLists(userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get friend lists: %w", err)
 	}
+	hiddenIDs, err := GetHiddenIDs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hidden users: %w", err)
+	}
+	conditions := []map[string]interface{}{
+		{"id": map[string]interface{}{"_nin": friendIDs}},
+		{"id": map[string]interface{}{"_nin": userIDs}},
+		{"id": map[string]interface{}{"_nin": hiddenIDs}},
+	}
+	if maxDistanceKm > 0 {
+		locations, err := resolvecity.GetLocations([]string{userID})
+		if err != nil {
+			return nil, err
+		}
+		origin, ok := locations[userID]
+		if !ok {
+			return nil, ErrNoLocation
+		}
+		nearbyIDs, err := resolvecity.GetUserIDsWithin(origin, maxDistanceKm)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, map[string]interface{}{"id": map[string]interface{}{"_in": nearbyIDs}})
+	}
+	orderBy := []map[string]interface{}{
+		{"similarity_score": "desc"},
+		{"id": "asc"},
+	}
 	query := `
-		mutation GetSimilarUsers($offset: Int!, $limit: Int!, $userID: String!, $friendIDs: [String!], $userIDs: [String!]) {
-			calculate_similarity_score(args: {user_id: $userID}, limit: $limit, offset: $offset, where: {
-				_and: [
-					{id: {_nin: $friendIDs}},
-					{id: {_nin: $userIDs}}
-				]
-			}) {
+		mutation GetSimilarUsers($limit: Int!, $userID: String!, $where: similarity_result_bool_exp!, $orderBy: [similarity_result_order_by!]) {
+			calculate_similarity_score(args: {user_id: $userID}, limit: $limit, where: $where, order_by: $orderBy) {
+				id
 				name
 				email
 				bio
@@ -156,51 +852,25 @@ func GetUsersFromHasura(offset, limit int, userID string) ([]User, error) {
 				interests
 				occupation
 				profile_picture
+				similarity_score
 			}
 		}
 	`
 	requestBody := map[string]interface{}{
 		"query": query,
 		"variables": map[string]interface{}{
-			"offset":    offset,
-			"limit":     limit,
-			"userID":    userID,
-			"friendIDs": friendIDs,
-			"userIDs":   userIDs,
+			"limit":   limit,
+			"userID":  userID,
+			"where":   map[string]interface{}{"_and": conditions},
+			"orderBy": orderBy,
 		},
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request body: %w", err)
-	}
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request to Hasura: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-	var responseBody struct {
-		Data struct {
-			Users []User `json:"calculate_similarity_score"`
-		} `json:"data"`
+	var responseData struct {
+		Users []User `json:"calculate_similarity_score"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get similar users: %w", err)
 	}
-	log.Printf("Hasura response: %+v", responseBody.Data.Users)
-	return responseBody.Data.Users, nil
+	log.Printf("Hasura response: %+v", responseData.Users)
+	return responseData.Users, nil
 }
@@ -0,0 +1,348 @@
+package githubimport
+
+import (
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	DefaultBaseURL     = "https://api.github.com"
+	GitHubProvider     = "oauth_github"
+	MaxRepos           = 30
+	MaxLanguages       = 5
+	MinLanguageShare   = 0.05
+	MaxInterestSources = 3
+)
+
+var LanguageNames = map[string]string{
+	"JavaScript": "JavaScript",
+	"TypeScript": "TypeScript",
+	"Python":     "Python",
+	"Java":       "Java",
+	"Ruby":       "Ruby",
+	"Go":         "Go",
+	"Dart":       "Dart",
+	"C":          "C/C++",
+	"C++":        "C/C++",
+	"C#":         "C#",
+	"PHP":        "PHP",
+	"Swift":      "Swift",
+	"Kotlin":     "Kotlin",
+	"Rust":       "Rust",
+	"Scala":      "Scala",
+	"Perl":       "Perl",
+	"R":          "R",
+	"Haskell":    "Haskell",
+	"Lua":        "Lua",
+	"Vue":        "JavaScript",
+}
+
+var LanguageInterests = map[string]string{
+	"HTML":             "Web Development",
+	"CSS":              "Web Development",
+	"Vue":              "Web Development",
+	"Svelte":           "Web Development",
+	"Jupyter Notebook": "Data Science",
+	"Solidity":         "Blockchain",
+	"GLSL":             "Graphics Programming",
+	"HLSL":             "Graphics Programming",
+	"Assembly":         "Low-level Programming",
+	"Dockerfile":       "DevOps",
+	"HCL":              "DevOps",
+	"GDScript":         "Game Development",
+}
+
+var TopicInterests = map[string]string{
+	"ar":                 "AR/VR",
+	"vr":                 "AR/VR",
+	"webxr":              "AR/VR",
+	"blockchain":         "Blockchain",
+	"ethereum":           "Blockchain",
+	"web3":               "Blockchain",
+	"security":           "Cybersecurity",
+	"cybersecurity":      "Cybersecurity",
+	"ctf":                "Cybersecurity",
+	"iot":                "IoT",
+	"arduino":            "IoT",
+	"raspberry-pi":       "IoT",
+	"big-data":           "Big Data",
+	"spark":              "Big Data",
+	"hadoop":             "Big Data",
+	"aws":                "Cloud Computing",
+	"azure":              "Cloud Computing",
+	"gcp":                "Cloud Computing",
+	"serverless":         "Cloud Computing",
+	"react":              "Web Development",
+	"vue":                "Web Development",
+	"nextjs":             "Web Development",
+	"nuxt":               "Web Development",
+	"web":                "Web Development",
+	"android":            "Mobile Development",
+	"ios":                "Mobile Development",
+	"flutter":            "Mobile Development",
+	"react-native":       "Mobile Development",
+	"machine-learning":   "Machine Learning",
+	"deep-learning":      "Machine Learning",
+	"pytorch":            "Machine Learning",
+	"tensorflow":         "Machine Learning",
+	"game":               "Game Development",
+	"gamedev":            "Game Development",
+	"game-development":   "Game Development",
+	"unity":              "Game Development",
+	"godot":              "Game Development",
+	"ui":                 "UI/UX Design",
+	"ux":                 "UI/UX Design",
+	"design":             "UI/UX Design",
+	"data-science":       "Data Science",
+	"data-analysis":      "Data Science",
+	"pandas":             "Data Science",
+	"devops":             "DevOps",
+	"docker":             "DevOps",
+	"kubernetes":         "DevOps",
+	"terraform":          "DevOps",
+	"kernel":             "Low-level Programming",
+	"operating-system":   "Low-level Programming",
+	"compiler":           "Low-level Programming",
+	"embedded":           "Low-level Programming",
+	"opengl":             "Graphics Programming",
+	"vulkan":             "Graphics Programming",
+	"webgl":              "Graphics Programming",
+	"graphics":           "Graphics Programming",
+	"computer-graphics":  "Graphics Programming",
+	"rendering":          "Graphics Programming",
+	"augmented-reality":  "AR/VR",
+	"virtual-reality":    "AR/VR",
+	"internet-of-things": "IoT",
+}
+
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+type Repo struct {
+	Name   string   `json:"name"`
+	Fork   bool     `json:"fork"`
+	Topics []string `json:"topics"`
+}
+
+type Suggestions struct {
+	Username      string           `json:"username"`
+	Language      []string         `json:"language"`
+	Interests     []string         `json:"interests"`
+	LanguageBytes map[string]int64 `json:"language_bytes"`
+	Topics        []string         `json:"topics"`
+	ReposScanned  int              `json:"repos_scanned"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to import GitHub profile")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	username := GitHubUsername(usr)
+	if username == "" {
+		http.Error(w, "No GitHub account is connected to this user", http.StatusNotFound)
+		log.Printf("User %s has no GitHub external account", userID)
+		return
+	}
+	suggestions, err := NewClient().Suggest(username)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import GitHub profile: %s", err), http.StatusBadGateway)
+		log.Printf("Error importing GitHub profile: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("GitHub suggestions successfully created for %s", username)
+}
+func GitHubUsername(usr *clerk.User) string {
+	for _, account := range usr.ExternalAccounts {
+		if account != nil && account.Provider == GitHubProvider && account.Username != nil {
+			return *account.Username
+		}
+	}
+	return ""
+}
+func NewClient() *Client {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+func (c *Client) get(path string, responseData interface{}) error {
+	req, err := http.NewRequest("GET", c.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from GitHub: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(responseData); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %w", err)
+	}
+	return nil
+}
+func (c *Client) GetRepos(username string) ([]Repo, error) {
+	var repos []Repo
+	path := fmt.Sprintf("/users/%s/repos?type=owner&sort=pushed&per_page=%d", url.PathEscape(username), MaxRepos)
+	if err := c.get(path, &repos); err != nil {
+		return nil, fmt.Errorf("failed to get repositories: %w", err)
+	}
+	return repos, nil
+}
+func (c *Client) GetLanguages(username string, repo Repo) (map[string]int64, error) {
+	languages := make(map[string]int64)
+	path := fmt.Sprintf("/repos/%s/%s/languages", url.PathEscape(username), url.PathEscape(repo.Name))
+	if err := c.get(path, &languages); err != nil {
+		return nil, fmt.Errorf("failed to get languages for %s: %w", repo.Name, err)
+	}
+	return languages, nil
+}
+func (c *Client) Suggest(username string) (*Suggestions, error) {
+	repos, err := c.GetRepos(username)
+	if err != nil {
+		return nil, err
+	}
+	suggestions := &Suggestions{
+		Username:      username,
+		LanguageBytes: make(map[string]int64),
+		Topics:        []string{},
+	}
+	topicCounts := make(map[string]int)
+	for _, repo := range repos {
+		if repo.Fork {
+			continue
+		}
+		languages, err := c.GetLanguages(username, repo)
+		if err != nil {
+			return nil, err
+		}
+		for language, bytes := range languages {
+			suggestions.LanguageBytes[language] += bytes
+		}
+		for _, topic := range repo.Topics {
+			topicCounts[strings.ToLower(topic)]++
+		}
+		suggestions.ReposScanned++
+	}
+	for topic := range topicCounts {
+		suggestions.Topics = append(suggestions.Topics, topic)
+	}
+	sort.Slice(suggestions.Topics, func(i, j int) bool {
+		if topicCounts[suggestions.Topics[i]] != topicCounts[suggestions.Topics[j]] {
+			return topicCounts[suggestions.Topics[i]] > topicCounts[suggestions.Topics[j]]
+		}
+		return suggestions.Topics[i] < suggestions.Topics[j]
+	})
+	suggestions.Language, suggestions.Interests = Aggregate(suggestions.LanguageBytes, topicCounts)
+	return suggestions, nil
+}
+func Aggregate(languageBytes map[string]int64, topicCounts map[string]int) ([]string, []string) {
+	var totalBytes int64
+	for _, bytes := range languageBytes {
+		totalBytes += bytes
+	}
+	languageTotals := make(map[string]int64)
+	interestScores := make(map[string]float64)
+	for language, bytes := range languageBytes {
+		if name, ok := LanguageNames[language]; ok {
+			languageTotals[name] += bytes
+		}
+		if interest, ok := LanguageInterests[language]; ok && totalBytes > 0 {
+			interestScores[interest] += float64(bytes) / float64(totalBytes) * MaxInterestSources
+		}
+	}
+	for topic, count := range topicCounts {
+		if interest, ok := TopicInterests[topic]; ok {
+			interestScores[interest] += float64(count)
+		}
+	}
+	languages := []string{}
+	for name, bytes := range languageTotals {
+		if totalBytes > 0 && float64(bytes)/float64(totalBytes) >= MinLanguageShare {
+			languages = append(languages, name)
+		}
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languageTotals[languages[i]] != languageTotals[languages[j]] {
+			return languageTotals[languages[i]] > languageTotals[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
+	if len(languages) > MaxLanguages {
+		languages = languages[:MaxLanguages]
+	}
+	interests := []string{}
+	for interest, score := range interestScores {
+		if score >= 1 {
+			interests = append(interests, interest)
+		}
+	}
+	sort.Slice(interests, func(i, j int) bool {
+		if interestScores[interests[i]] != interestScores[interests[j]] {
+			return interestScores[interests[i]] > interestScores[interests[j]]
+		}
+		return interests[i] < interests[j]
+	})
+	return languages, interests
+}
@@ -0,0 +1,95 @@
+package githubimport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newGitHubStub(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/octo/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "owner" {
+			t.Errorf("expected owned repositories to be requested, got %q", r.URL.RawQuery)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want the GITHUB_TOKEN bearer", got)
+		}
+		w.Write([]byte(`[
+			{"name": "api", "fork": false, "topics": ["Docker", "kubernetes"]},
+			{"name": "site", "fork": false, "topics": ["react"]},
+			{"name": "forked", "fork": true, "topics": ["ethereum"]}
+		]`))
+	})
+	mux.HandleFunc("/repos/octo/api/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Go": 8000, "Dockerfile": 200}`))
+	})
+	mux.HandleFunc("/repos/octo/site/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"TypeScript": 1500, "CSS": 250, "C": 50}`))
+	})
+	mux.HandleFunc("/repos/octo/forked/languages", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("languages of forked repositories should not be requested")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("GITHUB_API_URL", server.URL+"/")
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	return server
+}
+func TestSuggest(t *testing.T) {
+	newGitHubStub(t)
+	suggestions, err := NewClient().Suggest("octo")
+	if err != nil {
+		t.Fatalf("Suggest() error = %s", err)
+	}
+	if suggestions.ReposScanned != 2 {
+		t.Errorf("ReposScanned = %d, want 2", suggestions.ReposScanned)
+	}
+	if want := []string{"Go", "TypeScript"}; !reflect.DeepEqual(suggestions.Language, want) {
+		t.Errorf("Language = %v, want %v", suggestions.Language, want)
+	}
+	if want := []string{"DevOps", "Web Development"}; !reflect.DeepEqual(suggestions.Interests, want) {
+		t.Errorf("Interests = %v, want %v", suggestions.Interests, want)
+	}
+	if want := []string{"docker", "kubernetes", "react"}; !reflect.DeepEqual(suggestions.Topics, want) {
+		t.Errorf("Topics = %v, want %v", suggestions.Topics, want)
+	}
+	if suggestions.LanguageBytes["Go"] != 8000 || suggestions.LanguageBytes["CSS"] != 250 {
+		t.Errorf("LanguageBytes = %v, want the summed bytes per language", suggestions.LanguageBytes)
+	}
+}
+func TestSuggestUnknownUser(t *testing.T) {
+	newGitHubStub(t)
+	if _, err := NewClient().Suggest("missing"); err == nil {
+		t.Fatal("expected an error for a user GitHub does not know")
+	}
+}
+func TestAggregate(t *testing.T) {
+	languages, interests := Aggregate(map[string]int64{
+		"C":          300,
+		"C++":        300,
+		"Python":     200,
+		"Rust":       100,
+		"Java":       90,
+		"Kotlin":     80,
+		"Lua":        70,
+		"Makefile":   100,
+		"Solidity":   100,
+		"Shell":      40,
+		"JavaScript": 0,
+	}, map[string]int{"gamedev": 2, "unity": 1, "unknown-topic": 5})
+	if want := []string{"C/C++", "Python", "Rust", "Java", "Kotlin"}; !reflect.DeepEqual(languages, want) {
+		t.Errorf("languages = %v, want %v", languages, want)
+	}
+	if want := []string{"Game Development"}; !reflect.DeepEqual(interests, want) {
+		t.Errorf("interests = %v, want %v", interests, want)
+	}
+}
+func TestAggregateEmpty(t *testing.T) {
+	languages, interests := Aggregate(map[string]int64{}, map[string]int{})
+	if len(languages) != 0 || len(interests) != 0 {
+		t.Errorf("Aggregate() = %v, %v, want no suggestions", languages, interests)
+	}
+}
@@ -3,11 +3,14 @@ module api
 go 1.23
 
 require (
-	github.com/clerk/clerk-sdk-go/v2 v2.2.0 // indirect
+	github.com/clerk/clerk-sdk-go/v2 v2.2.0
+	github.com/pusher/pusher-http-go/v5 v5.1.1
+	github.com/svix/svix-webhooks v1.44.0
+)
+
+require (
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.1 // indirect
-	github.com/pusher/pusher-http-go/v5 v5.1.1 // indirect
-	github.com/svix/svix-webhooks v1.44.0 // indirect
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	gopkg.in/validator.v2 v2.0.1 // indirect
@@ -0,0 +1,92 @@
+package hasura
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+var ErrConstraint = errors.New("constraint violation")
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received Hasura health check")
+	cronSecret := os.Getenv("CRON_SECRET")
+	if cronSecret == "" || r.Header.Get("Authorization") != "Bearer "+cronSecret {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Hasura health check called without a valid cron secret")
+		return
+	}
+	requestBody := map[string]interface{}{
+		"query": "query HealthCheck { __typename }",
+	}
+	if err := Request(requestBody, nil); err != nil {
+		http.Error(w, "Hasura is unreachable", http.StatusServiceUnavailable)
+		log.Printf("Error reaching Hasura: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+func Request(requestBody map[string]interface{}, responseData interface{}) error {
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request body: %w", err)
+	}
+
+	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
+	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
+
+	req, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-hasura-admin-secret", hasuraSecret)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to Hasura: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	var responseBody struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	for _, hasuraError := range responseBody.Errors {
+		if hasuraError.Extensions.Code == "constraint-violation" {
+			return fmt.Errorf("%w: %s", ErrConstraint, hasuraError.Message)
+		}
+	}
+	if len(responseBody.Errors) > 0 {
+		messages := []string{}
+		for _, hasuraError := range responseBody.Errors {
+			messages = append(messages, hasuraError.Message)
+		}
+		return fmt.Errorf("hasura errors: %v", messages)
+	}
+	if responseData != nil {
+		if err := json.Unmarshal(responseBody.Data, responseData); err != nil {
+			return fmt.Errorf("failed to decode response data: %w", err)
+		}
+	}
+	return nil
+}
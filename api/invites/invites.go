@@ -0,0 +1,410 @@
+package invites
+
+import (
+	"api/addfriend"
+	"api/friends"
+	"api/hasura"
+	"api/updateseen"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	DefaultInviteExpiryDays = 14
+	MaxInviteExpiryDays     = 90
+	MaxActiveInvites        = 20
+	InviteURLPrefix         = "https://www.pairgrid.com/dashboard?invite="
+)
+
+var (
+	ErrInvalidInvite   = errors.New("invalid invite")
+	ErrInviteExpired   = errors.New("invite has expired")
+	ErrInviteRevoked   = errors.New("invite has been revoked")
+	ErrInviteRedeemed  = errors.New("invite already redeemed by this user")
+	ErrTooManyInvites  = fmt.Errorf("at most %d active invites are allowed", MaxActiveInvites)
+	ErrInviteNotFound  = errors.New("invite not found")
+	ErrMissingSecret   = errors.New("INVITE_SIGNING_SECRET is not set")
+	ErrConstraint      = hasura.ErrConstraint
+	errMalformedInvite = fmt.Errorf("%w: malformed token", ErrInvalidInvite)
+)
+
+type Claims struct {
+	InviteID  string `json:"iid"`
+	InviterID string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type Invite struct {
+	ID          string  `json:"id"`
+	InviterID   string  `json:"inviter_id"`
+	CreatedAt   string  `json:"created_at"`
+	ExpiresAt   string  `json:"expires_at"`
+	RevokedAt   *string `json:"revoked_at"`
+	Redemptions int     `json:"redemptions"`
+	URL         string  `json:"url,omitempty"`
+}
+
+type Stats struct {
+	Created  int `json:"created"`
+	Active   int `json:"active"`
+	Revoked  int `json:"revoked"`
+	Expired  int `json:"expired"`
+	Redeemed int `json:"redeemed"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for invites")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		invites, listErr := ListInvites(userID)
+		err = listErr
+		response = map[string]interface{}{"invites": invites, "stats": Summarize(invites, time.Now())}
+	case http.MethodPost:
+		expiryDays := DefaultInviteExpiryDays
+		if d := query.Get("expires_in_days"); d != "" {
+			expiryDays, err = strconv.Atoi(d)
+			if err != nil || expiryDays < 1 || expiryDays > MaxInviteExpiryDays {
+				http.Error(w, fmt.Sprintf("expires_in_days must be between 1 and %d", MaxInviteExpiryDays), http.StatusBadRequest)
+				return
+			}
+		}
+		response, err = CreateInvite(userID, time.Duration(expiryDays)*24*time.Hour)
+		if errors.Is(err, ErrTooManyInvites) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	case http.MethodDelete:
+		inviteID := query.Get("invite_id")
+		if inviteID == "" {
+			http.Error(w, "Missing invite_id query parameter", http.StatusBadRequest)
+			return
+		}
+		err = RevokeInvite(userID, inviteID)
+		if errors.Is(err, ErrInviteNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		response = map[string]string{"status": "revoked"}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do invite operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with invite operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Invite operation successfully completed")
+}
+func signingSecret() ([]byte, error) {
+	secret := os.Getenv("INVITE_SIGNING_SECRET")
+	if secret == "" {
+		return nil, ErrMissingSecret
+	}
+	return []byte(secret), nil
+}
+func signature(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+func Sign(claims Claims, secret []byte) (string, error) {
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode invite claims: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return payload + "." + signature(payload, secret), nil
+}
+func Verify(token string, secret []byte, now time.Time) (*Claims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || payload == "" || sig == "" {
+		return nil, errMalformedInvite
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(payload, secret))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidInvite)
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errMalformedInvite
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil || claims.InviteID == "" || claims.InviterID == "" {
+		return nil, errMalformedInvite
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrInviteExpired
+	}
+	return &claims, nil
+}
+func Summarize(invites []Invite, now time.Time) Stats {
+	stats := Stats{Created: len(invites)}
+	for _, invite := range invites {
+		stats.Redeemed += invite.Redemptions
+		if invite.RevokedAt != nil {
+			stats.Revoked++
+		} else if expiresAt, err := time.Parse(time.RFC3339Nano, invite.ExpiresAt); err == nil && !now.Before(expiresAt) {
+			stats.Expired++
+		} else {
+			stats.Active++
+		}
+	}
+	return stats
+}
+func CreateInvite(inviterID string, expiry time.Duration) (*Invite, error) {
+	secret, err := signingSecret()
+	if err != nil {
+		return nil, err
+	}
+	invites, err := ListInvites(inviterID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if Summarize(invites, now).Active >= MaxActiveInvites {
+		return nil, ErrTooManyInvites
+	}
+	expiresAt := now.Add(expiry)
+	mutation := `
+		mutation InsertInvite($object: invites_insert_input!) {
+			insert_invites_one(object: $object) {
+				id
+				inviter_id
+				created_at
+				expires_at
+				revoked_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"inviter_id": inviterID,
+				"created_at": now.Format(time.RFC3339Nano),
+				"expires_at": expiresAt.Format(time.RFC3339Nano),
+			},
+		},
+	}
+	var responseData struct {
+		InsertInvitesOne Invite `json:"insert_invites_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to insert invite: %w", err)
+	}
+	invite := responseData.InsertInvitesOne
+	token, err := Sign(Claims{InviteID: invite.ID, InviterID: inviterID, ExpiresAt: expiresAt.Unix()}, secret)
+	if err != nil {
+		return nil, err
+	}
+	invite.URL = InviteURLPrefix + token
+	return &invite, nil
+}
+func ListInvites(inviterID string) ([]Invite, error) {
+	query := `
+		query GetInvites($inviterID: String!) {
+			invites(where: {inviter_id: {_eq: $inviterID}}, order_by: {created_at: desc}) {
+				id
+				inviter_id
+				created_at
+				expires_at
+				revoked_at
+			}
+			invite_redemptions(where: {inviter_id: {_eq: $inviterID}}) {
+				invite_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"inviterID": inviterID,
+		},
+	}
+	var responseData struct {
+		Invites           []Invite `json:"invites"`
+		InviteRedemptions []struct {
+			InviteID string `json:"invite_id"`
+		} `json:"invite_redemptions"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	redemptions := make(map[string]int)
+	for _, redemption := range responseData.InviteRedemptions {
+		redemptions[redemption.InviteID]++
+	}
+	for i := range responseData.Invites {
+		responseData.Invites[i].Redemptions = redemptions[responseData.Invites[i].ID]
+	}
+	return responseData.Invites, nil
+}
+func RevokeInvite(inviterID, inviteID string) error {
+	mutation := `
+		mutation RevokeInvite($inviterID: String!, $inviteID: uuid!, $revokedAt: timestamptz!) {
+			update_invites(where: {id: {_eq: $inviteID}, inviter_id: {_eq: $inviterID}, revoked_at: {_is_null: true}}, _set: {revoked_at: $revokedAt}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"inviterID": inviterID,
+			"inviteID":  inviteID,
+			"revokedAt": time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		UpdateInvites struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_invites"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to revoke invite: %w", err)
+	}
+	if responseData.UpdateInvites.AffectedRows == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+func RedeemInvite(token, inviteeID string) (string, error) {
+	secret, err := signingSecret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := Verify(token, secret, now)
+	if err != nil {
+		return "", err
+	}
+	if claims.InviterID == inviteeID {
+		return "", fmt.Errorf("%w: cannot redeem own invite", ErrInvalidInvite)
+	}
+	query := `
+		query GetInvite($inviteID: uuid!, $inviteeID: String!) {
+			invites_by_pk(id: $inviteID) {
+				id
+				inviter_id
+				created_at
+				expires_at
+				revoked_at
+			}
+			invite_redemptions(where: {invite_id: {_eq: $inviteID}, invitee_id: {_eq: $inviteeID}}) {
+				invite_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"inviteID":  claims.InviteID,
+			"inviteeID": inviteeID,
+		},
+	}
+	var responseData struct {
+		InvitesByPk       *Invite `json:"invites_by_pk"`
+		InviteRedemptions []struct {
+			InviteID string `json:"invite_id"`
+		} `json:"invite_redemptions"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to get invite: %w", err)
+	}
+	invite := responseData.InvitesByPk
+	if invite == nil || invite.InviterID != claims.InviterID {
+		return "", ErrInviteNotFound
+	}
+	if invite.RevokedAt != nil {
+		return "", ErrInviteRevoked
+	}
+	if expiresAt, err := time.Parse(time.RFC3339Nano, invite.ExpiresAt); err == nil && !now.Before(expiresAt) {
+		return "", ErrInviteExpired
+	}
+	if len(responseData.InviteRedemptions) > 0 {
+		return "", ErrInviteRedeemed
+	}
+	if _, err := addfriend.ApplyFriendOperation(invite.InviterID, inviteeID, friends.OperationRequest, ""); err != nil && !errors.Is(err, friends.ErrFriendshipExists) {
+		return "", fmt.Errorf("failed to create invite friendship: %w", err)
+	}
+	if _, err := addfriend.ApplyFriendOperation(inviteeID, invite.InviterID, friends.OperationAccept, ""); err != nil && !errors.Is(err, friends.ErrNoFriendRequest) {
+		return "", fmt.Errorf("failed to accept invite friendship: %w", err)
+	}
+	mutation := `
+		mutation InsertInviteRedemption($object: invite_redemptions_insert_input!) {
+			insert_invite_redemptions_one(object: $object) {
+				invite_id
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"invite_id":   invite.ID,
+				"inviter_id":  invite.InviterID,
+				"invitee_id":  inviteeID,
+				"redeemed_at": now.Format(time.RFC3339Nano),
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); errors.Is(err, ErrConstraint) {
+		return "", ErrInviteRedeemed
+	} else if err != nil {
+		return "", fmt.Errorf("failed to record invite redemption: %w", err)
+	}
+	return invite.InviterID, nil
+}
@@ -0,0 +1,482 @@
+package messagerequests
+
+import (
+	"api/addfriend"
+	"api/auditlog"
+	"api/blockuser"
+	"api/friends"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusIgnored  = "ignored"
+
+	OperationAccept   = "accept"
+	OperationIgnore   = "ignore"
+	OperationBlock    = "block"
+	OperationSettings = "settings"
+
+	RouteDirect  = "direct"
+	RouteRequest = "request"
+	RouteIgnored = "ignored"
+)
+
+var (
+	ErrFriendshipRequired = errors.New("recipient only accepts messages from friends")
+	ErrNoMessageRequest   = errors.New("no message request found")
+)
+
+type MessageRequest struct {
+	SenderID       string  `json:"sender_id"`
+	RecipientID    string  `json:"recipient_id"`
+	Status         string  `json:"status"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+	ID             string  `json:"id,omitempty"`
+	Name           string  `json:"name,omitempty"`
+	Email          string  `json:"email,omitempty"`
+	ProfilePicture *string `json:"profile_picture,omitempty"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for message requests")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	operation := query.Get("operation")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	switch {
+	case r.Method == http.MethodGet && operation == OperationSettings:
+		var requireFriendship bool
+		requireFriendship, err = RequiresFriendship(userID)
+		response = map[string]bool{"require_friendship": requireFriendship}
+	case r.Method == http.MethodGet:
+		response, err = GetMessageRequests(userID, query.Get("status"))
+	case r.Method == http.MethodPost && operation == OperationSettings:
+		requireFriendship := query.Get("require_friendship") == "true"
+		if err = SetRequireFriendship(userID, requireFriendship); err == nil {
+			auditlog.Record(r, userID, "settings.require_friendship", userID, map[string]interface{}{"require_friendship": requireFriendship})
+		}
+		response = map[string]bool{"require_friendship": requireFriendship}
+	case r.Method == http.MethodPost:
+		senderID := query.Get("sender_id")
+		if senderID == "" {
+			http.Error(w, "Missing sender_id query parameter", http.StatusBadRequest)
+			return
+		}
+		addFriend := query.Get("add_friend") == "true"
+		var status string
+		status, err = Respond(userID, senderID, operation, addFriend)
+		if errors.Is(err, friends.ErrInvalidOperation) {
+			http.Error(w, "Invalid operation", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrNoMessageRequest) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			auditlog.Record(r, userID, "message_request."+operation, senderID, map[string]interface{}{"add_friend": addFriend})
+		}
+		response = map[string]string{"status": status}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do message request operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with message request operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Message request operation successfully completed")
+}
+func Route(senderID, recipientID string) (string, error) {
+	friendship, err := friends.Get(senderID, recipientID)
+	if err != nil {
+		return "", err
+	}
+	if friends.EffectiveStatus(friendship, time.Now()) == friends.StatusAccepted {
+		return RouteDirect, nil
+	}
+	query := `
+		query GetMessageRoute($senderID: String!, $recipientID: String!) {
+			message_requests(where: {_or: [
+				{sender_id: {_eq: $senderID}, recipient_id: {_eq: $recipientID}},
+				{sender_id: {_eq: $recipientID}, recipient_id: {_eq: $senderID}}
+			]}) {
+				sender_id
+				recipient_id
+				status
+			}
+			users_by_pk(id: $recipientID) {
+				require_friendship
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"senderID":    senderID,
+			"recipientID": recipientID,
+		},
+	}
+	var responseData struct {
+		MessageRequests []MessageRequest `json:"message_requests"`
+		User            *struct {
+			RequireFriendship *bool `json:"require_friendship"`
+		} `json:"users_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to get message route: %w", err)
+	}
+	var outgoing, incoming *MessageRequest
+	for i, request := range responseData.MessageRequests {
+		if request.Status == StatusAccepted {
+			return RouteDirect, nil
+		}
+		if request.SenderID == senderID {
+			outgoing = &responseData.MessageRequests[i]
+		} else {
+			incoming = &responseData.MessageRequests[i]
+		}
+	}
+	if incoming != nil && incoming.Status == StatusPending {
+		if err := setStatus(recipientID, senderID, StatusAccepted); err != nil {
+			return "", err
+		}
+		return RouteDirect, nil
+	}
+	if responseData.User != nil && responseData.User.RequireFriendship != nil && *responseData.User.RequireFriendship {
+		return "", ErrFriendshipRequired
+	}
+	if outgoing != nil && outgoing.Status == StatusIgnored {
+		return RouteIgnored, nil
+	}
+	if outgoing == nil {
+		if err := insertRequest(senderID, recipientID); err != nil {
+			return "", err
+		}
+	}
+	return RouteRequest, nil
+}
+func insertRequest(senderID, recipientID string) error {
+	now := time.Now().Format(time.RFC3339Nano)
+	mutation := `
+		mutation InsertMessageRequest($object: message_requests_insert_input!) {
+			insert_message_requests_one(object: $object, on_conflict: {constraint: message_requests_sender_id_recipient_id_key, update_columns: []}) {
+				status
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"sender_id":    senderID,
+				"recipient_id": recipientID,
+				"status":       StatusPending,
+				"created_at":   now,
+				"updated_at":   now,
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to insert message request: %w", err)
+	}
+	return nil
+}
+func OpenConversation(userID, partnerID string) error {
+	now := time.Now().Format(time.RFC3339Nano)
+	mutation := `
+		mutation OpenConversation($object: message_requests_insert_input!) {
+			insert_message_requests_one(object: $object, on_conflict: {constraint: message_requests_sender_id_recipient_id_key, update_columns: []}) {
+				status
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"sender_id":    userID,
+				"recipient_id": partnerID,
+				"status":       StatusAccepted,
+				"created_at":   now,
+				"updated_at":   now,
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to open conversation: %w", err)
+	}
+	return nil
+}
+func setStatus(senderID, recipientID, status string) error {
+	mutation := `
+		mutation SetMessageRequestStatus($senderID: String!, $recipientID: String!, $status: String!, $updatedAt: timestamptz!) {
+			update_message_requests(where: {sender_id: {_eq: $senderID}, recipient_id: {_eq: $recipientID}}, _set: {status: $status, updated_at: $updatedAt}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"senderID":    senderID,
+			"recipientID": recipientID,
+			"status":      status,
+			"updatedAt":   time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		UpdateMessageRequests struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_message_requests"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to update message request: %w", err)
+	}
+	if responseData.UpdateMessageRequests.AffectedRows == 0 {
+		return ErrNoMessageRequest
+	}
+	return nil
+}
+func Respond(recipientID, senderID, operation string, addFriend bool) (string, error) {
+	switch operation {
+	case OperationAccept:
+		if err := setStatus(senderID, recipientID, StatusAccepted); err != nil {
+			return "", err
+		}
+		if addFriend {
+			_, err := addfriend.ApplyFriendOperation(recipientID, senderID, friends.OperationRequest, "")
+			if err != nil && !errors.Is(err, friends.ErrFriendshipExists) && !errors.Is(err, friends.ErrFriendRequestSent) {
+				return "", fmt.Errorf("failed to send friend request: %w", err)
+			}
+		}
+		return StatusAccepted, nil
+	case OperationIgnore:
+		if err := setStatus(senderID, recipientID, StatusIgnored); err != nil {
+			return "", err
+		}
+		return StatusIgnored, nil
+	case OperationBlock:
+		if err := setStatus(senderID, recipientID, StatusIgnored); err != nil && !errors.Is(err, ErrNoMessageRequest) {
+			return "", err
+		}
+		if err := blockuser.Restrict(recipientID, senderID, blockuser.KindBlock); err != nil {
+			return "", err
+		}
+		return blockuser.KindBlock, nil
+	}
+	return "", friends.ErrInvalidOperation
+}
+func GetMessageRequests(userID, status string) ([]MessageRequest, error) {
+	where := map[string]interface{}{
+		"recipient_id": map[string]interface{}{"_eq": userID},
+		"status":       map[string]interface{}{"_eq": StatusPending},
+	}
+	if status == StatusAccepted {
+		where = map[string]interface{}{
+			"_or": []map[string]interface{}{
+				{"recipient_id": map[string]interface{}{"_eq": userID}},
+				{"sender_id": map[string]interface{}{"_eq": userID}},
+			},
+			"status": map[string]interface{}{"_eq": StatusAccepted},
+		}
+	}
+	query := `
+		query GetMessageRequests($where: message_requests_bool_exp!) {
+			message_requests(where: $where, order_by: {updated_at: desc}) {
+				sender_id
+				recipient_id
+				status
+				created_at
+				updated_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": where,
+		},
+	}
+	var responseData struct {
+		MessageRequests []MessageRequest `json:"message_requests"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get message requests: %w", err)
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	blocked := map[string]bool{}
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+	requests := []MessageRequest{}
+	counterpartIDs := []string{}
+	for _, request := range responseData.MessageRequests {
+		counterpartID := request.SenderID
+		if counterpartID == userID {
+			counterpartID = request.RecipientID
+		}
+		if !blocked[counterpartID] {
+			request.ID = counterpartID
+			requests = append(requests, request)
+			counterpartIDs = append(counterpartIDs, counterpartID)
+		}
+	}
+	if len(counterpartIDs) == 0 {
+		return requests, nil
+	}
+	usersQuery := `
+		query GetMessageRequestSenders($ids: [String!]!) {
+			users(where: {id: {_in: $ids}}) {
+				id
+				name
+				email
+				profile_picture
+			}
+		}
+	`
+	usersRequestBody := map[string]interface{}{
+		"query": usersQuery,
+		"variables": map[string]interface{}{
+			"ids": counterpartIDs,
+		},
+	}
+	var usersData struct {
+		Users []MessageRequest `json:"users"`
+	}
+	if err := hasura.Request(usersRequestBody, &usersData); err != nil {
+		return nil, fmt.Errorf("failed to get message request senders: %w", err)
+	}
+	counterparts := map[string]MessageRequest{}
+	for _, counterpart := range usersData.Users {
+		counterparts[counterpart.ID] = counterpart
+	}
+	for i, request := range requests {
+		counterpart := counterparts[request.ID]
+		requests[i].Name = counterpart.Name
+		requests[i].Email = counterpart.Email
+		requests[i].ProfilePicture = counterpart.ProfilePicture
+	}
+	return requests, nil
+}
+func RequiresFriendship(userID string) (bool, error) {
+	query := `
+		query GetRequireFriendship($userID: String!) {
+			users_by_pk(id: $userID) {
+				require_friendship
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		User *struct {
+			RequireFriendship *bool `json:"require_friendship"`
+		} `json:"users_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, fmt.Errorf("failed to get message settings: %w", err)
+	}
+	return responseData.User != nil && responseData.User.RequireFriendship != nil && *responseData.User.RequireFriendship, nil
+}
+func SetRequireFriendship(userID string, requireFriendship bool) error {
+	mutation := `
+		mutation SetRequireFriendship($userID: String!, $requireFriendship: Boolean!) {
+			update_users_by_pk(pk_columns: {id: $userID}, _set: {require_friendship: $requireFriendship}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":            userID,
+			"requireFriendship": requireFriendship,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to update message settings: %w", err)
+	}
+	return nil
+}
+func BroadcastMessageRequest(recipientID, senderID string) {
+	pusherID := os.Getenv("PUSHER_APP_ID")
+	pusherKey := os.Getenv("PUSHER_APP_KEY")
+	pusherSecret := os.Getenv("PUSHER_APP_SECRET")
+
+	pusherClient := pusher.Client{
+		AppID:   pusherID,
+		Key:     pusherKey,
+		Secret:  pusherSecret,
+		Cluster: "us2",
+		Secure:  true,
+	}
+	err := pusherClient.Trigger(fmt.Sprintf("notifications-%s", recipientID), "message-request", map[string]string{
+		"sender_id": senderID,
+	})
+	if err != nil {
+		log.Println("Error sending message request notification to Pusher:", err)
+	}
+}
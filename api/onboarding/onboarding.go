@@ -0,0 +1,405 @@
+package onboarding
+
+import (
+	"api/hasura"
+	"api/savedsearches"
+	"api/updateseen"
+	"api/updateuser"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	QuestionnaireVersion = 1
+	InclusionThreshold   = 2
+	MinBioLength         = 10
+	MaxBioLength         = 250
+)
+
+type Effects struct {
+	Language   map[string]int
+	Interests  map[string]int
+	Specialty  map[string]int
+	Occupation string
+}
+
+type Option struct {
+	ID      string  `json:"id"`
+	Label   string  `json:"label"`
+	Effects Effects `json:"-"`
+}
+
+type Question struct {
+	ID       string   `json:"id"`
+	Prompt   string   `json:"prompt"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []Option `json:"options,omitempty"`
+}
+
+type Questionnaire struct {
+	Version   int        `json:"version"`
+	Questions []Question `json:"questions"`
+}
+
+type Submission struct {
+	UserID  string              `json:"user_id"`
+	Version int                 `json:"version"`
+	Answers map[string][]string `json:"answers"`
+}
+
+type Status struct {
+	Onboarded     bool           `json:"onboarded"`
+	Version       int            `json:"version"`
+	Questionnaire *Questionnaire `json:"questionnaire,omitempty"`
+}
+
+func languageOption(language string) Option {
+	return Option{ID: strings.ToLower(language), Label: language, Effects: Effects{Language: map[string]int{language: 3}}}
+}
+func interestOption(interest string) Option {
+	return Option{ID: strings.ToLower(interest), Label: interest, Effects: Effects{Interests: map[string]int{interest: 2}}}
+}
+func occupationOption(occupation string) Option {
+	return Option{ID: strings.ToLower(occupation), Label: occupation, Effects: Effects{Occupation: occupation}}
+}
+
+var CurrentQuestionnaire = Questionnaire{
+	Version: QuestionnaireVersion,
+	Questions: []Question{
+		{
+			ID:       "goals",
+			Prompt:   "What do you want to build?",
+			Type:     "multi",
+			Required: true,
+			Options: []Option{
+				{ID: "websites", Label: "Websites and web apps", Effects: Effects{
+					Language:  map[string]int{"JavaScript": 1, "TypeScript": 1},
+					Interests: map[string]int{"Web Development": 2},
+					Specialty: map[string]int{"Full Stack Developer": 2, "Front-End Developer": 1},
+				}},
+				{ID: "apis", Label: "APIs and backend services", Effects: Effects{
+					Language:  map[string]int{"Go": 1, "Java": 1, "Python": 1},
+					Interests: map[string]int{"Web Development": 1, "Cloud Computing": 1},
+					Specialty: map[string]int{"Back-End Developer": 2},
+				}},
+				{ID: "mobile", Label: "Mobile apps", Effects: Effects{
+					Language:  map[string]int{"Swift": 1, "Kotlin": 1, "Dart": 1},
+					Interests: map[string]int{"Mobile Development": 2},
+					Specialty: map[string]int{"Mobile Developer": 2},
+				}},
+				{ID: "games", Label: "Games", Effects: Effects{
+					Language:  map[string]int{"C#": 1, "C/C++": 1},
+					Interests: map[string]int{"Game Development": 2, "Graphics Programming": 1},
+					Specialty: map[string]int{"Game Developer": 2},
+				}},
+				{ID: "ml", Label: "Machine learning models", Effects: Effects{
+					Language:  map[string]int{"Python": 2},
+					Interests: map[string]int{"Machine Learning": 2, "Data Science": 1},
+					Specialty: map[string]int{"Machine Learning Engineer": 2},
+				}},
+				{ID: "data", Label: "Data pipelines and analysis", Effects: Effects{
+					Language:  map[string]int{"Python": 1, "R": 1, "Scala": 1},
+					Interests: map[string]int{"Data Science": 2, "Big Data": 2},
+					Specialty: map[string]int{"Data Scientist": 2},
+				}},
+				{ID: "infrastructure", Label: "Infrastructure and tooling", Effects: Effects{
+					Language:  map[string]int{"Go": 1},
+					Interests: map[string]int{"DevOps": 2, "Cloud Computing": 2},
+					Specialty: map[string]int{"DevOps Engineer": 2, "Cloud Engineer": 1},
+				}},
+				{ID: "hardware", Label: "Embedded and low-level software", Effects: Effects{
+					Language:  map[string]int{"C/C++": 2, "Rust": 1},
+					Interests: map[string]int{"Low-level Programming": 2, "IoT": 1},
+					Specialty: map[string]int{"Embedded Systems Engineer": 2},
+				}},
+				{ID: "security", Label: "Security tools", Effects: Effects{
+					Interests: map[string]int{"Cybersecurity": 2},
+				}},
+				{ID: "design", Label: "Interfaces and user experiences", Effects: Effects{
+					Interests: map[string]int{"UI/UX Design": 2},
+					Specialty: map[string]int{"Designer": 2, "Front-End Developer": 1},
+				}},
+			},
+		},
+		{
+			ID:       "languages",
+			Prompt:   "Which programming languages have you used?",
+			Type:     "multi",
+			Required: false,
+			Options: []Option{
+				languageOption("JavaScript"), languageOption("TypeScript"), languageOption("Python"), languageOption("Java"),
+				languageOption("Ruby"), languageOption("Go"), languageOption("Dart"), languageOption("C/C++"),
+				languageOption("C#"), languageOption("PHP"), languageOption("Swift"), languageOption("Kotlin"),
+				languageOption("Rust"), languageOption("Scala"), languageOption("Perl"), languageOption("R"),
+				languageOption("Haskell"), languageOption("Lua"),
+			},
+		},
+		{
+			ID:       "curious",
+			Prompt:   "What else are you curious about?",
+			Type:     "multi",
+			Required: false,
+			Options: []Option{
+				interestOption("AR/VR"), interestOption("Blockchain"), interestOption("Cybersecurity"), interestOption("IoT"),
+				interestOption("Big Data"), interestOption("Cloud Computing"), interestOption("Web Development"),
+				interestOption("Mobile Development"), interestOption("Machine Learning"), interestOption("Game Development"),
+				interestOption("UI/UX Design"), interestOption("Data Science"), interestOption("DevOps"),
+				interestOption("Low-level Programming"), interestOption("Graphics Programming"),
+			},
+		},
+		{
+			ID:       "occupation",
+			Prompt:   "Where are you in your journey?",
+			Type:     "single",
+			Required: true,
+			Options: []Option{
+				occupationOption("Middle School Student"), occupationOption("High School Student"),
+				occupationOption("Undergraduate Student"), occupationOption("Graduate Student"),
+				occupationOption("Professional"), occupationOption("Hobbyist"), occupationOption("Educator"),
+			},
+		},
+		{
+			ID:       "bio",
+			Prompt:   "Tell us about yourself in a sentence",
+			Type:     "text",
+			Required: true,
+		},
+	},
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for onboarding")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+			return
+		}
+		if userID != usr.ID {
+			http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+			return
+		}
+		updateseen.UpdateUserInHasura(userID)
+		onboarded, version, err := GetOnboardingStatus(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get onboarding status: %s", err), http.StatusInternalServerError)
+			log.Printf("Error getting onboarding status: %s", err)
+			return
+		}
+		status := Status{Onboarded: onboarded, Version: version}
+		if !onboarded || version < QuestionnaireVersion {
+			status.Questionnaire = &CurrentQuestionnaire
+		}
+		response = status
+	case http.MethodPost:
+		var submission Submission
+		if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+			log.Printf("Error decoding JSON payload: %s", err)
+			return
+		}
+		if submission.UserID != usr.ID {
+			http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, submission.UserID)
+			return
+		}
+		updateseen.UpdateUserInHasura(submission.UserID)
+		if submission.Version != QuestionnaireVersion {
+			http.Error(w, fmt.Sprintf("Questionnaire version %d is out of date, expected %d", submission.Version, QuestionnaireVersion), http.StatusConflict)
+			return
+		}
+		profile, err := ScoreAnswers(CurrentQuestionnaire, submission.Answers)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid answers: %s", err), http.StatusBadRequest)
+			return
+		}
+		profile.ID = submission.UserID
+		if err := CompleteOnboarding(profile, submission); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to complete onboarding: %s", err), http.StatusInternalServerError)
+			log.Printf("Error completing onboarding: %s", err)
+			return
+		}
+		if err := savedsearches.EvaluateProfile(profile.ID); err != nil {
+			log.Printf("Error evaluating saved searches: %s", err)
+		}
+		response = profile
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Onboarding request successfully completed")
+}
+func ScoreAnswers(questionnaire Questionnaire, answers map[string][]string) (*updateuser.UpdateUserRequest, error) {
+	languageScores := make(map[string]int)
+	interestScores := make(map[string]int)
+	specialtyScores := make(map[string]int)
+	specialtyOrder := []string{}
+	profile := &updateuser.UpdateUserRequest{Language: []string{}, Interests: []string{}}
+	for _, question := range questionnaire.Questions {
+		answer := answers[question.ID]
+		if question.Required && len(answer) == 0 {
+			return nil, fmt.Errorf("question %q is required", question.ID)
+		}
+		if question.Type == "text" {
+			if len(answer) > 1 {
+				return nil, fmt.Errorf("question %q expects a single answer", question.ID)
+			}
+			if len(answer) == 1 {
+				bio := strings.TrimSpace(answer[0])
+				if len(bio) < MinBioLength || len(bio) > MaxBioLength {
+					return nil, fmt.Errorf("question %q must be between %d and %d characters", question.ID, MinBioLength, MaxBioLength)
+				}
+				profile.Bio = bio
+			}
+			continue
+		}
+		if question.Type == "single" && len(answer) > 1 {
+			return nil, fmt.Errorf("question %q expects a single answer", question.ID)
+		}
+		options := make(map[string]Option, len(question.Options))
+		for _, option := range question.Options {
+			options[option.ID] = option
+		}
+		for _, optionID := range answer {
+			option, ok := options[optionID]
+			if !ok {
+				return nil, fmt.Errorf("invalid option %q for question %q", optionID, question.ID)
+			}
+			for language, score := range option.Effects.Language {
+				languageScores[language] += score
+			}
+			for interest, score := range option.Effects.Interests {
+				interestScores[interest] += score
+			}
+			for specialty, score := range option.Effects.Specialty {
+				if _, seen := specialtyScores[specialty]; !seen {
+					specialtyOrder = append(specialtyOrder, specialty)
+				}
+				specialtyScores[specialty] += score
+			}
+			if option.Effects.Occupation != "" {
+				profile.Occupation = option.Effects.Occupation
+			}
+		}
+	}
+	for language, score := range languageScores {
+		if score >= InclusionThreshold {
+			profile.Language = append(profile.Language, language)
+		}
+	}
+	for interest, score := range interestScores {
+		if score >= InclusionThreshold {
+			profile.Interests = append(profile.Interests, interest)
+		}
+	}
+	sort.Strings(profile.Language)
+	sort.Strings(profile.Interests)
+	sort.SliceStable(specialtyOrder, func(i, j int) bool {
+		return specialtyScores[specialtyOrder[i]] > specialtyScores[specialtyOrder[j]]
+	})
+	if len(specialtyOrder) > 0 {
+		profile.Specialty = specialtyOrder[0]
+	}
+	return profile, nil
+}
+func CompleteOnboarding(profile *updateuser.UpdateUserRequest, submission Submission) error {
+	if err := updateuser.UpdateUserInHasura(*profile); err != nil {
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+	mutation := `
+		mutation CompleteOnboarding($userID: String!, $version: Int!, $answers: jsonb!, $onboardedAt: timestamptz!) {
+			update_users_by_pk(
+				pk_columns: {id: $userID},
+				_set: {onboarded: true, onboarding_version: $version, onboarding_answers: $answers, onboarded_at: $onboardedAt}
+			) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":      profile.ID,
+			"version":     submission.Version,
+			"answers":     submission.Answers,
+			"onboardedAt": time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to store onboarding completion: %w", err)
+	}
+	return nil
+}
+func GetOnboardingStatus(userID string) (bool, int, error) {
+	query := `
+		query GetOnboardingStatus($userID: String!) {
+			users_by_pk(id: $userID) {
+				onboarded
+				onboarding_version
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		User *struct {
+			Onboarded         *bool `json:"onboarded"`
+			OnboardingVersion *int  `json:"onboarding_version"`
+		} `json:"users_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, 0, fmt.Errorf("failed to get onboarding status: %w", err)
+	}
+	if responseData.User == nil {
+		return false, 0, fmt.Errorf("user not found")
+	}
+	onboarded := responseData.User.Onboarded != nil && *responseData.User.Onboarded
+	version := 0
+	if responseData.User.OnboardingVersion != nil {
+		version = *responseData.User.OnboardingVersion
+	}
+	return onboarded, version, nil
+}
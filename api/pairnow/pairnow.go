@@ -0,0 +1,573 @@
+package pairnow
+
+import (
+	"api/blockuser"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+const DefaultQueueTTLSeconds = 120
+
+var ErrSuspended = errors.New("suspended users cannot join the pair now queue")
+
+type QueueEntry struct {
+	UserID    string   `json:"user_id"`
+	Name      string   `json:"name"`
+	Languages []string `json:"languages"`
+	Specialty string   `json:"specialty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+}
+
+type Match struct {
+	PartnerID   string `json:"partner_id"`
+	PartnerName string `json:"partner_name"`
+	Initiator   bool   `json:"initiator"`
+	MatchedAt   string `json:"matched_at"`
+}
+
+type QueueStatus struct {
+	State     string `json:"state"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Match     *Match `json:"match,omitempty"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for pair now queue")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	operation := query.Get("operation")
+	if userID == "" || operation == "" {
+		http.Error(w, "Missing user_id or operation query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	if operation == "join" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		var entry QueueEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+			log.Printf("Error decoding JSON payload: %s", err)
+			return
+		}
+		if len(entry.Languages) == 0 && entry.Specialty == "" {
+			http.Error(w, "At least one language or a specialty is required", http.StatusBadRequest)
+			return
+		}
+		entry.UserID = userID
+		response, err = JoinQueue(entry)
+	} else if operation == "leave" {
+		err = LeaveQueue(userID)
+		response = QueueStatus{State: "idle"}
+	} else if operation == "status" {
+		response, err = GetQueueStatus(userID)
+	} else {
+		http.Error(w, "Invalid operation", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrSuspended) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do queue operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with queue operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Queue operation successfully completed")
+}
+func QueueTTL() time.Duration {
+	seconds := DefaultQueueTTLSeconds
+	if s := os.Getenv("PAIR_NOW_TTL_SECONDS"); s != "" {
+		if parsedSeconds, err := strconv.Atoi(s); err == nil && parsedSeconds > 0 {
+			seconds = parsedSeconds
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+func Compatibility(a, b QueueEntry) int {
+	score := 0
+	for _, la := range a.Languages {
+		for _, lb := range b.Languages {
+			if strings.EqualFold(la, lb) {
+				score += 2
+			}
+		}
+	}
+	if a.Specialty != "" && strings.EqualFold(a.Specialty, b.Specialty) {
+		score++
+	}
+	return score
+}
+func getSuspendedIDs(userIDs []string) (map[string]bool, error) {
+	query := `
+		query GetSuspendedUsers($userIDs: [String!]!) {
+			users(where: {id: {_in: $userIDs}, suspended: {_eq: true}}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userIDs": userIDs,
+		},
+	}
+	var responseData struct {
+		Users []struct {
+			ID string `json:"id"`
+		} `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get suspended users: %w", err)
+	}
+	suspended := make(map[string]bool, len(responseData.Users))
+	for _, u := range responseData.Users {
+		suspended[u.ID] = true
+	}
+	return suspended, nil
+}
+func getUserName(userID string) (string, error) {
+	query := `
+		query GetUserName($userID: String!) {
+			users_by_pk(id: $userID) {
+				name
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		UsersByPk *struct {
+			Name string `json:"name"`
+		} `json:"users_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to get user name: %w", err)
+	}
+	if responseData.UsersByPk == nil {
+		return "", fmt.Errorf("failed to get user name: user %s not found", userID)
+	}
+	return responseData.UsersByPk.Name, nil
+}
+func JoinQueue(entry QueueEntry) (*QueueStatus, error) {
+	name, err := getUserName(entry.UserID)
+	if err != nil {
+		return nil, err
+	}
+	entry.Name = name
+	now := time.Now()
+	mutation := `
+		mutation CleanQueue($now: timestamptz!, $userID: String!) {
+			delete_pair_queue(where: {_or: [{expires_at: {_lt: $now}}, {user_id: {_eq: $userID}}]}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"now":    now.Format(time.RFC3339Nano),
+			"userID": entry.UserID,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return nil, fmt.Errorf("failed to clean queue: %w", err)
+	}
+	candidates, err := getCandidates(entry, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		claimed, err := claimEntry(entry.UserID, candidate.UserID, now)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return completeMatch(entry, candidate, now), nil
+		}
+	}
+	entry.CreatedAt = now.Format(time.RFC3339Nano)
+	entry.ExpiresAt = now.Add(QueueTTL()).Format(time.RFC3339Nano)
+	if err := enqueue(entry); err != nil {
+		return nil, fmt.Errorf("failed to join queue: %w", err)
+	}
+	candidates, err = getCandidates(entry, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		selfClaimed, partnerClaimed, err := claimPair(entry.UserID, candidate.UserID, now)
+		if err != nil {
+			return nil, err
+		}
+		if selfClaimed && partnerClaimed {
+			return completeMatch(entry, candidate, now), nil
+		}
+		if partnerClaimed {
+			if err := enqueue(candidate); err != nil {
+				return nil, fmt.Errorf("failed to restore queue entry: %w", err)
+			}
+		}
+		if !selfClaimed {
+			return GetQueueStatus(entry.UserID)
+		}
+		if err := enqueue(entry); err != nil {
+			return nil, fmt.Errorf("failed to rejoin queue: %w", err)
+		}
+	}
+	return &QueueStatus{State: "waiting", ExpiresAt: entry.ExpiresAt}, nil
+}
+func getCandidates(entry QueueEntry, now time.Time) ([]QueueEntry, error) {
+	query := `
+		query GetQueue($now: timestamptz!) {
+			pair_queue(where: {expires_at: {_gte: $now}}, order_by: {created_at: asc}) {
+				user_id
+				name
+				languages
+				specialty
+				created_at
+				expires_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"now": now.Format(time.RFC3339Nano),
+		},
+	}
+	var queueData struct {
+		PairQueue []QueueEntry `json:"pair_queue"`
+	}
+	if err := hasura.Request(requestBody, &queueData); err != nil {
+		return nil, fmt.Errorf("failed to get queue: %w", err)
+	}
+	queueIDs := []string{entry.UserID}
+	for _, waiting := range queueData.PairQueue {
+		queueIDs = append(queueIDs, waiting.UserID)
+	}
+	suspended, err := getSuspendedIDs(queueIDs)
+	if err != nil {
+		return nil, err
+	}
+	if suspended[entry.UserID] {
+		return nil, ErrSuspended
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(entry.UserID)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+	candidates := []QueueEntry{}
+	for _, waiting := range queueData.PairQueue {
+		if waiting.UserID != entry.UserID && !blocked[waiting.UserID] && !suspended[waiting.UserID] && Compatibility(entry, waiting) > 0 {
+			candidates = append(candidates, waiting)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return Compatibility(entry, candidates[i]) > Compatibility(entry, candidates[j])
+	})
+	return candidates, nil
+}
+func enqueue(entry QueueEntry) error {
+	mutation := `
+		mutation JoinQueue($object: pair_queue_insert_input!) {
+			insert_pair_queue_one(object: $object) {
+				user_id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"user_id":    entry.UserID,
+				"name":       entry.Name,
+				"languages":  entry.Languages,
+				"specialty":  entry.Specialty,
+				"created_at": entry.CreatedAt,
+				"expires_at": entry.ExpiresAt,
+			},
+		},
+	}
+	return hasura.Request(requestBody, nil)
+}
+func completeMatch(entry, candidate QueueEntry, now time.Time) *QueueStatus {
+	matchedAt := now.Format(time.RFC3339Nano)
+	BroadcastMatch(candidate.UserID, Match{PartnerID: entry.UserID, PartnerName: entry.Name, Initiator: false, MatchedAt: matchedAt})
+	match := Match{PartnerID: candidate.UserID, PartnerName: candidate.Name, Initiator: true, MatchedAt: matchedAt}
+	BroadcastMatch(entry.UserID, match)
+	return &QueueStatus{State: "matched", Match: &match}
+}
+func claimEntry(initiatorID, partnerID string, now time.Time) (bool, error) {
+	mutation := `
+		mutation ClaimQueueEntry($partnerID: String!, $now: timestamptz!, $match: pair_now_matches_insert_input!) {
+			delete_pair_queue(where: {user_id: {_eq: $partnerID}, expires_at: {_gte: $now}}) {
+				affected_rows
+			}
+			insert_pair_now_matches_one(object: $match) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"partnerID": partnerID,
+			"now":       now.Format(time.RFC3339Nano),
+			"match":     matchObject(initiatorID, partnerID, now),
+		},
+	}
+	var responseData struct {
+		DeletePairQueue struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_pair_queue"`
+		InsertPairNowMatchesOne *struct {
+			ID interface{} `json:"id"`
+		} `json:"insert_pair_now_matches_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, fmt.Errorf("failed to claim queue entry: %w", err)
+	}
+	if responseData.DeletePairQueue.AffectedRows == 1 {
+		return true, nil
+	}
+	if responseData.InsertPairNowMatchesOne != nil {
+		if err := deleteMatch(responseData.InsertPairNowMatchesOne.ID); err != nil {
+			log.Printf("Error removing pair now match for a lost claim: %s", err)
+		}
+	}
+	return false, nil
+}
+func claimPair(userID, partnerID string, now time.Time) (bool, bool, error) {
+	firstID, secondID := userID, partnerID
+	if secondID < firstID {
+		firstID, secondID = secondID, firstID
+	}
+	mutation := `
+		mutation ClaimQueuePair($firstID: String!, $secondID: String!, $now: timestamptz!, $match: pair_now_matches_insert_input!) {
+			first: delete_pair_queue(where: {user_id: {_eq: $firstID}, expires_at: {_gte: $now}}) {
+				affected_rows
+			}
+			second: delete_pair_queue(where: {user_id: {_eq: $secondID}, expires_at: {_gte: $now}}) {
+				affected_rows
+			}
+			insert_pair_now_matches_one(object: $match) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"firstID":  firstID,
+			"secondID": secondID,
+			"now":      now.Format(time.RFC3339Nano),
+			"match":    matchObject(userID, partnerID, now),
+		},
+	}
+	var responseData struct {
+		First struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"first"`
+		Second struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"second"`
+		InsertPairNowMatchesOne *struct {
+			ID interface{} `json:"id"`
+		} `json:"insert_pair_now_matches_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, false, fmt.Errorf("failed to claim queue pair: %w", err)
+	}
+	claimed := map[string]bool{
+		firstID:  responseData.First.AffectedRows == 1,
+		secondID: responseData.Second.AffectedRows == 1,
+	}
+	if !(claimed[userID] && claimed[partnerID]) && responseData.InsertPairNowMatchesOne != nil {
+		if err := deleteMatch(responseData.InsertPairNowMatchesOne.ID); err != nil {
+			log.Printf("Error removing pair now match for a lost claim: %s", err)
+		}
+	}
+	return claimed[userID], claimed[partnerID], nil
+}
+func matchObject(initiatorID, partnerID string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"initiator_id": initiatorID,
+		"partner_id":   partnerID,
+		"matched_at":   now.Format(time.RFC3339Nano),
+	}
+}
+func deleteMatch(matchID interface{}) error {
+	mutation := `
+		mutation DeleteMatch($id: bigint!) {
+			delete_pair_now_matches_by_pk(id: $id) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"id": matchID,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to delete pair now match: %w", err)
+	}
+	return nil
+}
+func LeaveQueue(userID string) error {
+	mutation := `
+		mutation LeaveQueue($userID: String!) {
+			delete_pair_queue(where: {user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	return hasura.Request(requestBody, nil)
+}
+func GetQueueStatus(userID string) (*QueueStatus, error) {
+	now := time.Now()
+	query := `
+		query GetQueueStatus($userID: String!, $now: timestamptz!, $since: timestamptz!) {
+			pair_queue(where: {user_id: {_eq: $userID}, expires_at: {_gte: $now}}) {
+				expires_at
+			}
+			pair_now_matches(
+				where: {_or: [{initiator_id: {_eq: $userID}}, {partner_id: {_eq: $userID}}], matched_at: {_gte: $since}},
+				order_by: {matched_at: desc},
+				limit: 1
+			) {
+				initiator_id
+				partner_id
+				matched_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+			"now":    now.Format(time.RFC3339Nano),
+			"since":  now.Add(-QueueTTL()).Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		PairQueue []struct {
+			ExpiresAt string `json:"expires_at"`
+		} `json:"pair_queue"`
+		PairNowMatches []struct {
+			InitiatorID string `json:"initiator_id"`
+			PartnerID   string `json:"partner_id"`
+			MatchedAt   string `json:"matched_at"`
+		} `json:"pair_now_matches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get queue status: %w", err)
+	}
+	if len(responseData.PairQueue) > 0 {
+		return &QueueStatus{State: "waiting", ExpiresAt: responseData.PairQueue[0].ExpiresAt}, nil
+	}
+	if len(responseData.PairNowMatches) > 0 {
+		m := responseData.PairNowMatches[0]
+		match := Match{PartnerID: m.PartnerID, Initiator: true, MatchedAt: m.MatchedAt}
+		if m.PartnerID == userID {
+			match = Match{PartnerID: m.InitiatorID, Initiator: false, MatchedAt: m.MatchedAt}
+		}
+		return &QueueStatus{State: "matched", Match: &match}, nil
+	}
+	return &QueueStatus{State: "idle"}, nil
+}
+func BroadcastMatch(userID string, match Match) {
+	pusherID := os.Getenv("PUSHER_APP_ID")
+	pusherKey := os.Getenv("PUSHER_APP_KEY")
+	pusherSecret := os.Getenv("PUSHER_APP_SECRET")
+
+	pusherClient := pusher.Client{
+		AppID:   pusherID,
+		Key:     pusherKey,
+		Secret:  pusherSecret,
+		Cluster: "us2",
+		Secure:  true,
+	}
+	err := pusherClient.Trigger(
+		fmt.Sprintf("private-call-%s", userID),
+		"pair-matched",
+		map[string]interface{}{
+			"partner_id":   match.PartnerID,
+			"partner_name": match.PartnerName,
+			"initiator":    match.Initiator,
+			"matched_at":   match.MatchedAt,
+		},
+	)
+	if err != nil {
+		log.Printf("Error broadcasting pair match: %s", err)
+	} else {
+		log.Printf("Pair match sent to %s", userID)
+	}
+}
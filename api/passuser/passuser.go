@@ -0,0 +1,238 @@
+package passuser
+
+import (
+	"api/addfriend"
+	"api/getrequests"
+	"api/getusers"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const MaxReasonLength = 200
+
+type Pass struct {
+	PassedID  string `json:"passed_id"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+}
+
+type PassedUser struct {
+	User      getrequests.User `json:"user"`
+	Reason    string           `json:"reason"`
+	CreatedAt string           `json:"created_at"`
+	ExpiresAt string           `json:"expires_at"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to update passes in Hasura")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	operation := query.Get("operation")
+
+	if userID == "" || operation == "" {
+		http.Error(w, "Missing user_id or operation query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	if operation == "list" {
+		limit, err := getusers.ParsePageSize(query.Get("limit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := getusers.DecodeCursor(query.Get("cursor"))
+		if err != nil || cursor.Score != nil {
+			http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+			log.Printf("Error decoding cursor: %v", err)
+			return
+		}
+		page, err := ListPasses(userID, cursor, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list passes: %s", err), http.StatusInternalServerError)
+			log.Printf("Error listing passes: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+			log.Printf("Error creating response JSON: %s", err)
+			return
+		}
+		log.Printf("Passes successfully retrieved from Hasura")
+		return
+	}
+
+	candidateEmail := query.Get("candidate_email")
+	if candidateEmail == "" {
+		http.Error(w, "Missing candidate_email query parameter", http.StatusBadRequest)
+		return
+	}
+	candidateID, err := addfriend.GetFriendIDByEmail(candidateEmail)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to find candidate by email: %s", err), http.StatusInternalServerError)
+		log.Printf("Error finding candidate by email: %s", err)
+		return
+	}
+	if candidateID == userID {
+		http.Error(w, "Cannot pass on self", http.StatusBadRequest)
+		return
+	}
+	if operation == "pass" {
+		reason := strings.TrimSpace(query.Get("reason"))
+		if len([]rune(reason)) > MaxReasonLength {
+			http.Error(w, fmt.Sprintf("Reason must be at most %d characters", MaxReasonLength), http.StatusBadRequest)
+			return
+		}
+		err = InsertPass(userID, candidateID, reason)
+	} else if operation == "undo" {
+		err = DeletePass(userID, candidateID)
+	} else {
+		http.Error(w, "Invalid operation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do pass operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with pass operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message":"Pass operation successfully completed"}`))
+	log.Printf("Pass operation successfully completed")
+}
+func InsertPass(userID, passedID, reason string) error {
+	mutation := `
+		mutation InsertPass($userID: String!, $passedID: String!, $reason: String!, $createdAt: timestamptz!) {
+			insert_passes_one(
+				object: {user_id: $userID, passed_id: $passedID, reason: $reason, created_at: $createdAt},
+				on_conflict: {constraint: passes_user_id_passed_id_key, update_columns: [reason, created_at]}
+			) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":    userID,
+			"passedID":  passedID,
+			"reason":    reason,
+			"createdAt": time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	return hasura.Request(requestBody, nil)
+}
+func DeletePass(userID, passedID string) error {
+	mutation := `
+		mutation DeletePass($userID: String!, $passedID: String!) {
+			delete_passes(where: {user_id: {_eq: $userID}, passed_id: {_eq: $passedID}}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":   userID,
+			"passedID": passedID,
+		},
+	}
+	var responseData struct {
+		DeletePasses struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_passes"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return err
+	}
+	if responseData.DeletePasses.AffectedRows == 0 {
+		return fmt.Errorf("no pass found to undo")
+	}
+	return nil
+}
+func ListPasses(userID string, cursor getusers.Cursor, limit int) (*getusers.Page, error) {
+	query := `
+		query GetPasses($userID: String!, $since: timestamptz!) {
+			passes(where: {user_id: {_eq: $userID}, created_at: {_gte: $since}}) {
+				passed_id
+				reason
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+			"since":  time.Now().Add(-getusers.PassCooldown()).Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		Passes []Pass `json:"passes"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, err
+	}
+	passes := make(map[string]Pass, len(responseData.Passes))
+	passedIDs := make([]string, len(responseData.Passes))
+	for i, pass := range responseData.Passes {
+		passes[pass.PassedID] = pass
+		passedIDs[i] = pass.PassedID
+	}
+	pageIDs, nextCursor, prevCursor := getusers.PageIDs(passedIDs, cursor, limit)
+	users, err := getrequests.GetUsersInfo(pageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passed users info: %w", err)
+	}
+	passedUsers := []PassedUser{}
+	for _, u := range users {
+		pass := passes[u.ID]
+		expiresAt := ""
+		if createdAt, err := time.Parse(time.RFC3339Nano, pass.CreatedAt); err == nil {
+			expiresAt = createdAt.Add(getusers.PassCooldown()).Format(time.RFC3339Nano)
+		}
+		passedUsers = append(passedUsers, PassedUser{
+			User:      u,
+			Reason:    pass.Reason,
+			CreatedAt: pass.CreatedAt,
+			ExpiresAt: expiresAt,
+		})
+	}
+	return &getusers.Page{Data: passedUsers, NextCursor: nextCursor, PrevCursor: prevCursor}, nil
+}
@@ -0,0 +1,782 @@
+package projects
+
+import (
+	"api/addfriend"
+	"api/auditlog"
+	"api/blockuser"
+	"api/friends"
+	"api/getrequests"
+	"api/getusers"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	MaxTitleLength       = 100
+	MaxDescriptionLength = 2000
+	CandidatePoolSize    = 200
+)
+
+var (
+	ErrNotOwner             = errors.New("only the project owner can do this")
+	ErrProjectNotFound      = errors.New("project not found")
+	ErrInvalidCursor        = errors.New("invalid cursor query parameter")
+	ErrBlocked              = errors.New("applications between these users are blocked")
+	ErrNoPendingApplication = errors.New("no pending application found for this applicant")
+)
+
+var ProjectStatuses = []string{"open", "in_progress", "closed"}
+
+type Project struct {
+	ID                  interface{} `json:"id,omitempty"`
+	Title               string      `json:"title"`
+	Description         string      `json:"description"`
+	RequiredLanguages   []string    `json:"required_languages"`
+	RequiredSpecialties []string    `json:"required_specialties"`
+	Status              string      `json:"status"`
+	OwnerID             string      `json:"owner_id"`
+	CreatedAt           string      `json:"created_at,omitempty"`
+	MatchScore          int64       `json:"match_score,omitempty"`
+}
+
+type Application struct {
+	ProjectID   interface{}      `json:"project_id"`
+	ApplicantID string           `json:"applicant_id"`
+	Status      string           `json:"status"`
+	CreatedAt   string           `json:"created_at"`
+	Applicant   getrequests.User `json:"applicant"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for projects in Hasura")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	operation := query.Get("operation")
+	projectID := query.Get("project_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+	limit, err := getusers.ParsePageSize(query.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := getusers.DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		log.Printf("Error decoding cursor: %s", err)
+		return
+	}
+
+	var response interface{}
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		if operation == "" || operation == "list" {
+			response, err = ListProjects(userID, "", "open", cursor, limit)
+		} else if operation == "mine" {
+			response, err = ListProjects(userID, userID, "", cursor, limit)
+		} else if operation == "get" {
+			response, err = GetProject(projectID)
+		} else if operation == "recommend" {
+			response, err = RecommendProjects(userID, cursor, limit)
+		} else if operation == "candidates" {
+			if (cursor.After != "" || cursor.Before != "") && cursor.Score == nil {
+				http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+				return
+			}
+			if err = requireOwner(projectID, userID); err == nil {
+				response, err = RecommendCandidates(projectID, cursor, limit)
+			}
+		} else if operation == "applicants" {
+			if err = requireOwner(projectID, userID); err == nil {
+				response, err = ListApplications(projectID, userID)
+			}
+		} else {
+			http.Error(w, "Invalid operation", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if operation == "" || operation == "create" {
+			var project Project
+			if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+				log.Printf("Error decoding JSON payload: %s", err)
+				return
+			}
+			project.OwnerID = userID
+			if project.Status == "" {
+				project.Status = "open"
+			}
+			if err := ValidateProject(project); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid project: %s", err), http.StatusBadRequest)
+				return
+			}
+			response, err = CreateProject(project)
+			status = http.StatusCreated
+		} else if operation == "apply" {
+			response, err = Apply(projectID, userID)
+		} else if operation == "accept" {
+			applicantID := query.Get("applicant_id")
+			if applicantID == "" {
+				http.Error(w, "Missing applicant_id query parameter", http.StatusBadRequest)
+				return
+			}
+			if err = requireOwner(projectID, userID); err == nil {
+				response, err = AcceptApplicant(projectID, userID, applicantID)
+			}
+			if err == nil {
+				auditlog.Record(r, userID, "project.accept", applicantID, map[string]interface{}{"project_id": projectID, "friendship": friends.StatusAccepted})
+			}
+		} else {
+			http.Error(w, "Invalid operation", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPut:
+		var project Project
+		if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+			log.Printf("Error decoding JSON payload: %s", err)
+			return
+		}
+		project.OwnerID = userID
+		if err := ValidateProject(project); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid project: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err = requireOwner(projectID, userID); err == nil {
+			response, err = UpdateProject(projectID, project)
+		}
+	case http.MethodDelete:
+		if err = requireOwner(projectID, userID); err == nil {
+			response, err = DeleteProject(projectID)
+		}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, ErrNotOwner) || errors.Is(err, ErrBlocked) || errors.Is(err, addfriend.ErrBlocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrNoPendingApplication) || errors.Is(err, friends.ErrNoFriendRequest) || errors.Is(err, friends.ErrFriendConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, friends.ErrDeclineCooldown) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, ErrProjectNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do project operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with project operation: %s", err)
+		return
+	}
+	w.WriteHeader(status)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Project operation successfully completed")
+}
+func ValidateProject(project Project) error {
+	title := strings.TrimSpace(project.Title)
+	if title == "" || len(title) > MaxTitleLength {
+		return fmt.Errorf("title must be between 1 and %d characters", MaxTitleLength)
+	}
+	if len(project.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", MaxDescriptionLength)
+	}
+	if len(project.RequiredLanguages) == 0 && len(project.RequiredSpecialties) == 0 {
+		return fmt.Errorf("at least one required language or specialty is needed")
+	}
+	for _, s := range ProjectStatuses {
+		if project.Status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid status %q, expected one of %s", project.Status, strings.Join(ProjectStatuses, ", "))
+}
+func requireOwner(projectID, userID string) error {
+	if projectID == "" {
+		return fmt.Errorf("missing project_id query parameter")
+	}
+	project, err := GetProject(projectID)
+	if err != nil {
+		return err
+	}
+	if project.OwnerID != userID {
+		return ErrNotOwner
+	}
+	return nil
+}
+func CreateProject(project Project) (*Project, error) {
+	mutation := `
+		mutation InsertProject($object: projects_insert_input!) {
+			insert_projects_one(object: $object) {
+				id
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"title":                strings.TrimSpace(project.Title),
+				"description":          project.Description,
+				"required_languages":   project.RequiredLanguages,
+				"required_specialties": project.RequiredSpecialties,
+				"status":               project.Status,
+				"owner_id":             project.OwnerID,
+				"created_at":           time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	var responseData struct {
+		InsertProjectsOne struct {
+			ID        interface{} `json:"id"`
+			CreatedAt string      `json:"created_at"`
+		} `json:"insert_projects_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to insert project: %w", err)
+	}
+	project.ID = responseData.InsertProjectsOne.ID
+	project.CreatedAt = responseData.InsertProjectsOne.CreatedAt
+	return &project, nil
+}
+func UpdateProject(projectID string, project Project) (map[string]string, error) {
+	mutation := `
+		mutation UpdateProject($id: bigint!, $changes: projects_set_input!) {
+			update_projects_by_pk(pk_columns: {id: $id}, _set: $changes) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"id": projectID,
+			"changes": map[string]interface{}{
+				"title":                strings.TrimSpace(project.Title),
+				"description":          project.Description,
+				"required_languages":   project.RequiredLanguages,
+				"required_specialties": project.RequiredSpecialties,
+				"status":               project.Status,
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return nil, fmt.Errorf("failed to update project: %w", err)
+	}
+	return map[string]string{"status": "success"}, nil
+}
+func DeleteProject(projectID string) (map[string]string, error) {
+	mutation := `
+		mutation DeleteProject($id: bigint!) {
+			delete_project_applications(where: {project_id: {_eq: $id}}) {
+				affected_rows
+			}
+			delete_projects_by_pk(id: $id) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"id": projectID,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return nil, fmt.Errorf("failed to delete project: %w", err)
+	}
+	return map[string]string{"status": "success"}, nil
+}
+func GetProject(projectID string) (*Project, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("missing project_id query parameter")
+	}
+	query := `
+		query GetProject($id: bigint!) {
+			projects_by_pk(id: $id) {
+				id
+				title
+				description
+				required_languages
+				required_specialties
+				status
+				owner_id
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"id": projectID,
+		},
+	}
+	var responseData struct {
+		Project *Project `json:"projects_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if responseData.Project == nil {
+		return nil, fmt.Errorf("%w: %s", ErrProjectNotFound, projectID)
+	}
+	return responseData.Project, nil
+}
+func ListProjects(viewerID, ownerID, status string, cursor getusers.Cursor, limit int) (*getusers.Page, error) {
+	if (cursor.After != "" || cursor.Before != "") && cursor.CreatedAt == "" {
+		return nil, ErrInvalidCursor
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []map[string]interface{}{
+		{"owner_id": map[string]interface{}{"_nin": blockedIDs}},
+	}
+	if ownerID != "" {
+		conditions = append(conditions, map[string]interface{}{"owner_id": map[string]interface{}{"_eq": ownerID}})
+	}
+	if status != "" {
+		conditions = append(conditions, map[string]interface{}{"status": map[string]interface{}{"_eq": status}})
+	}
+	orderBy := []map[string]interface{}{
+		{"created_at": "desc"},
+		{"id": "desc"},
+	}
+	if cursor.After != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"_or": []map[string]interface{}{
+				{"created_at": map[string]interface{}{"_lt": cursor.CreatedAt}},
+				{"created_at": map[string]interface{}{"_eq": cursor.CreatedAt}, "id": map[string]interface{}{"_lt": cursor.After}},
+			},
+		})
+	} else if cursor.Before != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"_or": []map[string]interface{}{
+				{"created_at": map[string]interface{}{"_gt": cursor.CreatedAt}},
+				{"created_at": map[string]interface{}{"_eq": cursor.CreatedAt}, "id": map[string]interface{}{"_gt": cursor.Before}},
+			},
+		})
+		orderBy = []map[string]interface{}{
+			{"created_at": "asc"},
+			{"id": "asc"},
+		}
+	}
+	query := `
+		query GetProjects($where: projects_bool_exp!, $orderBy: [projects_order_by!], $limit: Int!) {
+			projects(where: $where, order_by: $orderBy, limit: $limit) {
+				id
+				title
+				description
+				required_languages
+				required_specialties
+				status
+				owner_id
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where":   map[string]interface{}{"_and": conditions},
+			"orderBy": orderBy,
+			"limit":   limit + 1,
+		},
+	}
+	var responseData struct {
+		Projects []Project `json:"projects"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	projects := responseData.Projects
+	hasMore := len(projects) > limit
+	if hasMore {
+		projects = projects[:limit]
+	}
+	if cursor.Before != "" {
+		for i, j := 0, len(projects)-1; i < j; i, j = i+1, j-1 {
+			projects[i], projects[j] = projects[j], projects[i]
+		}
+	}
+	page := getusers.Page{Data: projects}
+	if len(projects) > 0 {
+		first, last := projects[0], projects[len(projects)-1]
+		if hasMore || cursor.Before != "" {
+			page.NextCursor = getusers.EncodeCursor(getusers.Cursor{CreatedAt: last.CreatedAt, After: fmt.Sprint(last.ID)})
+		}
+		if (cursor.Before != "" && hasMore) || cursor.After != "" {
+			page.PrevCursor = getusers.EncodeCursor(getusers.Cursor{CreatedAt: first.CreatedAt, Before: fmt.Sprint(first.ID)})
+		}
+	}
+	return &page, nil
+}
+func MatchScore(project Project, language []string, specialty string) int64 {
+	score := int64(0)
+	for _, required := range project.RequiredLanguages {
+		for _, l := range language {
+			if strings.EqualFold(required, l) {
+				score += 2
+			}
+		}
+	}
+	for _, required := range project.RequiredSpecialties {
+		if specialty != "" && strings.EqualFold(required, specialty) {
+			score += 3
+		}
+	}
+	return score
+}
+func RecommendProjects(userID string, cursor getusers.Cursor, limit int) (*getusers.Page, error) {
+	if (cursor.After != "" || cursor.Before != "") && cursor.Score == nil {
+		return nil, ErrInvalidCursor
+	}
+	users, err := getrequests.GetUsersInfo([]string{userID})
+	if err != nil || len(users) == 0 {
+		return nil, fmt.Errorf("failed to get user profile: %v", err)
+	}
+	profile := users[0]
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		query GetOpenProjects($excludedIDs: [String!]!, $limit: Int!) {
+			projects(where: {status: {_eq: "open"}, owner_id: {_nin: $excludedIDs}}, limit: $limit, order_by: {created_at: desc}) {
+				id
+				title
+				description
+				required_languages
+				required_specialties
+				status
+				owner_id
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"excludedIDs": append(blockedIDs, userID),
+			"limit":       CandidatePoolSize,
+		},
+	}
+	var responseData struct {
+		Projects []Project `json:"projects"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get open projects: %w", err)
+	}
+	recommended := []Project{}
+	for _, project := range responseData.Projects {
+		project.MatchScore = MatchScore(project, profile.Language, profile.Specialty)
+		if project.MatchScore > 0 {
+			recommended = append(recommended, project)
+		}
+	}
+	page := PageProjects(recommended, cursor, limit)
+	return &page, nil
+}
+func PageProjects(projects []Project, cursor getusers.Cursor, limit int) getusers.Page {
+	sort.SliceStable(projects, func(i, j int) bool {
+		if projects[i].MatchScore != projects[j].MatchScore {
+			return projects[i].MatchScore > projects[j].MatchScore
+		}
+		return fmt.Sprint(projects[i].ID) < fmt.Sprint(projects[j].ID)
+	})
+	comesBefore := func(p Project, score float64, id string) bool {
+		return float64(p.MatchScore) > score || (float64(p.MatchScore) == score && fmt.Sprint(p.ID) < id)
+	}
+	start, end := 0, len(projects)
+	if cursor.Before != "" && cursor.Score != nil {
+		end = sort.Search(len(projects), func(i int) bool {
+			return !comesBefore(projects[i], *cursor.Score, cursor.Before)
+		})
+		start = end - limit
+		if start < 0 {
+			start = 0
+		}
+	} else {
+		if cursor.After != "" && cursor.Score != nil {
+			start = sort.Search(len(projects), func(i int) bool {
+				return !comesBefore(projects[i], *cursor.Score, cursor.After) && !(float64(projects[i].MatchScore) == *cursor.Score && fmt.Sprint(projects[i].ID) == cursor.After)
+			})
+		}
+		if start+limit < end {
+			end = start + limit
+		}
+	}
+	pageProjects := projects[start:end]
+	page := getusers.Page{Data: pageProjects}
+	if len(pageProjects) == 0 {
+		return page
+	}
+	first, last := pageProjects[0], pageProjects[len(pageProjects)-1]
+	if end < len(projects) {
+		score := float64(last.MatchScore)
+		page.NextCursor = getusers.EncodeCursor(getusers.Cursor{Score: &score, After: fmt.Sprint(last.ID)})
+	}
+	if start > 0 {
+		score := float64(first.MatchScore)
+		page.PrevCursor = getusers.EncodeCursor(getusers.Cursor{Score: &score, Before: fmt.Sprint(first.ID)})
+	}
+	return page
+}
+func RecommendCandidates(projectID string, cursor getusers.Cursor, limit int) (*getusers.Page, error) {
+	project, err := GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(project.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		query GetCandidates($excludedIDs: [String!]!, $limit: Int!) {
+			users(where: {id: {_nin: $excludedIDs}, suspended: {_neq: true}}, limit: $limit, order_by: {last_seen: desc_nulls_last}) {
+				id
+				name
+				email
+				bio
+				language
+				specialty
+				interests
+				occupation
+				profile_picture
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"excludedIDs": append(blockedIDs, project.OwnerID),
+			"limit":       CandidatePoolSize,
+		},
+	}
+	var responseData struct {
+		Users []getusers.User `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get candidates: %w", err)
+	}
+	candidates := []getusers.User{}
+	for _, u := range responseData.Users {
+		u.SimilarityScore = MatchScore(*project, u.Language, u.Specialty)
+		u.MatchScore = float64(u.SimilarityScore)
+		if u.SimilarityScore > 0 {
+			candidates = append(candidates, u)
+		}
+	}
+	page := getusers.PageUsers(candidates, cursor, limit)
+	return &page, nil
+}
+func Apply(projectID, userID string) (map[string]string, error) {
+	project, err := GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.OwnerID == userID {
+		return nil, fmt.Errorf("cannot apply to own project")
+	}
+	if project.Status != "open" {
+		return nil, fmt.Errorf("project is not open for applications")
+	}
+	blocked, err := blockuser.IsBlocked(userID, project.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+	mutation := `
+		mutation InsertApplication($projectID: bigint!, $applicantID: String!, $createdAt: timestamptz!) {
+			insert_project_applications_one(
+				object: {project_id: $projectID, applicant_id: $applicantID, status: "pending", created_at: $createdAt},
+				on_conflict: {constraint: project_applications_project_id_applicant_id_key, update_columns: []}
+			) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"projectID":   projectID,
+			"applicantID": userID,
+			"createdAt":   time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return nil, fmt.Errorf("failed to insert application: %w", err)
+	}
+	return map[string]string{"status": "applied"}, nil
+}
+func ListApplications(projectID, ownerID string) ([]Application, error) {
+	blockedIDs, err := blockuser.GetBlockedIDs(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		query GetApplications($projectID: bigint!, $blockedIDs: [String!]!) {
+			project_applications(where: {project_id: {_eq: $projectID}, applicant_id: {_nin: $blockedIDs}}, order_by: {created_at: asc}) {
+				project_id
+				applicant_id
+				status
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"projectID":  projectID,
+			"blockedIDs": blockedIDs,
+		},
+	}
+	var responseData struct {
+		Applications []Application `json:"project_applications"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get applications: %w", err)
+	}
+	applicantIDs := make([]string, len(responseData.Applications))
+	for i, a := range responseData.Applications {
+		applicantIDs[i] = a.ApplicantID
+	}
+	users, err := getrequests.GetUsersInfo(applicantIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applicants info: %w", err)
+	}
+	applicants := make(map[string]getrequests.User, len(users))
+	for _, u := range users {
+		applicants[u.ID] = u
+	}
+	for i, a := range responseData.Applications {
+		responseData.Applications[i].Applicant = applicants[a.ApplicantID]
+	}
+	return responseData.Applications, nil
+}
+func AcceptApplicant(projectID, ownerID, applicantID string) (map[string]string, error) {
+	query := `
+		query GetPendingApplication($projectID: bigint!, $applicantID: String!) {
+			project_applications(where: {project_id: {_eq: $projectID}, applicant_id: {_eq: $applicantID}, status: {_eq: "pending"}}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"projectID":   projectID,
+			"applicantID": applicantID,
+		},
+	}
+	var applicationData struct {
+		ProjectApplications []struct {
+			ID interface{} `json:"id"`
+		} `json:"project_applications"`
+	}
+	if err := hasura.Request(requestBody, &applicationData); err != nil {
+		return nil, fmt.Errorf("failed to get application: %w", err)
+	}
+	if len(applicationData.ProjectApplications) == 0 {
+		return nil, ErrNoPendingApplication
+	}
+	status, err := addfriend.ApplyFriendOperation(ownerID, applicantID, friends.OperationRequest, "")
+	if errors.Is(err, friends.ErrFriendshipExists) {
+		status = friends.StatusAccepted
+	} else if err != nil && !errors.Is(err, friends.ErrFriendRequestSent) {
+		return nil, err
+	}
+	if status != friends.StatusAccepted {
+		if _, err := addfriend.ApplyFriendOperation(applicantID, ownerID, friends.OperationAccept, ""); err != nil {
+			return nil, err
+		}
+	}
+	mutation := `
+		mutation AcceptApplication($projectID: bigint!, $applicantID: String!) {
+			update_project_applications(
+				where: {project_id: {_eq: $projectID}, applicant_id: {_eq: $applicantID}, status: {_eq: "pending"}},
+				_set: {status: "accepted"}
+			) {
+				affected_rows
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"projectID":   projectID,
+			"applicantID": applicantID,
+		},
+	}
+	var responseData struct {
+		UpdateProjectApplications struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_project_applications"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to accept application: %w", err)
+	}
+	if responseData.UpdateProjectApplications.AffectedRows == 0 {
+		return nil, ErrNoPendingApplication
+	}
+	return map[string]string{"status": "accepted"}, nil
+}
@@ -0,0 +1,643 @@
+package reports
+
+import (
+	"api/auditlog"
+	"api/getmessages"
+	"api/hasura"
+	"api/roles"
+	"api/updateseen"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+const (
+	StatusOpen     = "open"
+	StatusAssigned = "assigned"
+	StatusResolved = "resolved"
+
+	ActionAssign  = "assign"
+	ActionResolve = "resolve"
+	ActionWarn    = "warn"
+	ActionSuspend = "suspend"
+
+	MaxDetailsLength = 1000
+	MaxNoteLength    = 500
+)
+
+var Categories = []string{"harassment", "spam", "hate_speech", "inappropriate_content", "impersonation", "other"}
+
+var (
+	ErrInvalidReport   = errors.New("invalid report")
+	ErrMessageMismatch = errors.New("message does not belong to this conversation")
+	ErrReportNotFound  = errors.New("report not found")
+	ErrReportResolved  = errors.New("report is already resolved")
+	ErrInvalidAction   = errors.New("invalid action")
+)
+
+type Report struct {
+	ID         string  `json:"id"`
+	ReporterID string  `json:"reporter_id"`
+	ReportedID string  `json:"reported_id"`
+	MessageID  *string `json:"message_id"`
+	Category   string  `json:"category"`
+	Details    string  `json:"details"`
+	Evidence   *string `json:"evidence"`
+	Status     string  `json:"status"`
+	AssigneeID *string `json:"assignee_id"`
+	Resolution *string `json:"resolution"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+type Warning struct {
+	ID        string `json:"id,omitempty"`
+	UserID    string `json:"user_id"`
+	ReportID  string `json:"report_id"`
+	Category  string `json:"category"`
+	Note      string `json:"note"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ModerationAction struct {
+	ReportID    *string `json:"report_id"`
+	ModeratorID string  `json:"moderator_id"`
+	Action      string  `json:"action"`
+	TargetID    string  `json:"target_id"`
+	Note        string  `json:"note"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for reports")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	operation := query.Get("operation")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	if r.Method == http.MethodPost && operation == "" {
+		var report Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+			log.Printf("Error decoding JSON payload: %s", err)
+			return
+		}
+		report.ReporterID = userID
+		response, err = CreateReport(report)
+		if errors.Is(err, ErrInvalidReport) || errors.Is(err, ErrMessageMismatch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if r.Method == http.MethodGet && operation == "warnings" {
+		response, err = GetWarnings(userID)
+	} else {
+		if !roles.HasRole(usr, roles.StaffRoles...) {
+			http.Error(w, "Moderator role required", http.StatusForbidden)
+			log.Printf("User %s attempted to access the moderation queue without a moderator role", userID)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && operation == "queue":
+			response, err = GetQueue(query.Get("status"))
+		case r.Method == http.MethodGet && operation == "actions":
+			response, err = GetModerationActions(query.Get("report_id"))
+		case r.Method == http.MethodPost:
+			reportID := query.Get("report_id")
+			if reportID == "" {
+				http.Error(w, "Missing report_id query parameter", http.StatusBadRequest)
+				return
+			}
+			note := strings.TrimSpace(query.Get("note"))
+			if len(note) > MaxNoteLength {
+				http.Error(w, fmt.Sprintf("Note must be at most %d characters", MaxNoteLength), http.StatusBadRequest)
+				return
+			}
+			response, err = ApplyAction(r.Context(), reportID, userID, operation, query.Get("assignee_id"), note)
+			if err == nil {
+				auditlog.Record(r, userID, "report."+operation, reportID, map[string]interface{}{"note": note})
+			}
+			if errors.Is(err, ErrInvalidAction) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, ErrReportNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, ErrReportResolved) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		default:
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do report operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with report operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Report operation successfully completed")
+}
+func ValidateReport(report Report) error {
+	if report.ReportedID == "" || report.ReportedID == report.ReporterID {
+		return fmt.Errorf("%w: reported_id must be another user", ErrInvalidReport)
+	}
+	validCategory := false
+	for _, category := range Categories {
+		if report.Category == category {
+			validCategory = true
+		}
+	}
+	if !validCategory {
+		return fmt.Errorf("%w: category must be one of %s", ErrInvalidReport, strings.Join(Categories, ", "))
+	}
+	if len(report.Details) > MaxDetailsLength {
+		return fmt.Errorf("%w: details must be at most %d characters", ErrInvalidReport, MaxDetailsLength)
+	}
+	return nil
+}
+func CreateReport(report Report) (*Report, error) {
+	report.Details = strings.TrimSpace(report.Details)
+	if err := ValidateReport(report); err != nil {
+		return nil, err
+	}
+	object := map[string]interface{}{
+		"reporter_id": report.ReporterID,
+		"reported_id": report.ReportedID,
+		"category":    report.Category,
+		"details":     report.Details,
+		"status":      StatusOpen,
+		"created_at":  time.Now().Format(time.RFC3339Nano),
+		"updated_at":  time.Now().Format(time.RFC3339Nano),
+	}
+	if report.MessageID != nil && *report.MessageID != "" {
+		evidence, err := GetMessageEvidence(*report.MessageID, report.ReporterID, report.ReportedID)
+		if err != nil {
+			return nil, err
+		}
+		object["message_id"] = *report.MessageID
+		object["evidence"] = evidence
+	}
+	mutation := `
+		mutation InsertReport($object: reports_insert_input!) {
+			insert_reports_one(object: $object) {
+				id
+				reporter_id
+				reported_id
+				message_id
+				category
+				details
+				status
+				created_at
+				updated_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": object,
+		},
+	}
+	var responseData struct {
+		InsertReportsOne Report `json:"insert_reports_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to insert report: %w", err)
+	}
+	return &responseData.InsertReportsOne, nil
+}
+func GetMessageEvidence(messageID, reporterID, reportedID string) (string, error) {
+	query := `
+		query GetReportedMessage($where: messages_bool_exp!) {
+			messages(where: $where, limit: 1) {
+				id
+				sender_id
+				recipient_id
+				encrypted_content
+				created_at
+				key
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": map[string]interface{}{
+				"id":           map[string]interface{}{"_eq": messageID},
+				"sender_id":    map[string]interface{}{"_eq": reportedID},
+				"recipient_id": map[string]interface{}{"_eq": reporterID},
+			},
+		},
+	}
+	var responseData struct {
+		Messages []getmessages.Message `json:"messages"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return "", fmt.Errorf("failed to get reported message: %w", err)
+	}
+	if len(responseData.Messages) == 0 {
+		return "", ErrMessageMismatch
+	}
+	message := responseData.Messages[0]
+	key := getmessages.GenerateEncryptionKey(message.SenderID, os.Getenv("ENCRYPTION_KEY"))
+	decrypted, err := getmessages.DecryptMessage(message.EncryptedContent, message.Key, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt reported message: %w", err)
+	}
+	return decrypted, nil
+}
+func GetQueue(status string) ([]Report, error) {
+	statuses := []string{StatusOpen, StatusAssigned}
+	if status != "" {
+		statuses = []string{status}
+	}
+	query := `
+		query GetReportQueue($statuses: [String!]!) {
+			reports(where: {status: {_in: $statuses}}, order_by: {created_at: asc}) {
+				id
+				reporter_id
+				reported_id
+				message_id
+				category
+				details
+				evidence
+				status
+				assignee_id
+				resolution
+				created_at
+				updated_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"statuses": statuses,
+		},
+	}
+	var responseData struct {
+		Reports []Report `json:"reports"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get report queue: %w", err)
+	}
+	return responseData.Reports, nil
+}
+func GetReport(reportID string) (*Report, error) {
+	query := `
+		query GetReport($where: reports_bool_exp!) {
+			reports(where: $where, limit: 1) {
+				id
+				reporter_id
+				reported_id
+				message_id
+				category
+				details
+				evidence
+				status
+				assignee_id
+				resolution
+				created_at
+				updated_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": map[string]interface{}{"id": map[string]interface{}{"_eq": reportID}},
+		},
+	}
+	var responseData struct {
+		Reports []Report `json:"reports"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+	if len(responseData.Reports) == 0 {
+		return nil, ErrReportNotFound
+	}
+	return &responseData.Reports[0], nil
+}
+func ApplyAction(ctx context.Context, reportID, moderatorID, action, assigneeID, note string) (*Report, error) {
+	report, err := GetReport(reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == StatusResolved {
+		return nil, ErrReportResolved
+	}
+	changes := map[string]interface{}{
+		"updated_at": time.Now().Format(time.RFC3339Nano),
+	}
+	switch action {
+	case ActionAssign:
+		if assigneeID == "" {
+			assigneeID = moderatorID
+		}
+		changes["status"] = StatusAssigned
+		changes["assignee_id"] = assigneeID
+	case ActionResolve:
+		changes["status"] = StatusResolved
+		changes["resolution"] = "dismissed"
+	case ActionWarn:
+		changes["status"] = StatusResolved
+		changes["resolution"] = "warned"
+	case ActionSuspend:
+		changes["status"] = StatusResolved
+		changes["resolution"] = "suspended"
+	default:
+		return nil, ErrInvalidAction
+	}
+	if changes["status"] == StatusResolved && changes["assignee_id"] == nil && report.AssigneeID == nil {
+		changes["assignee_id"] = moderatorID
+	}
+	mutation := `
+		mutation UpdateReport($where: reports_bool_exp!, $changes: reports_set_input!) {
+			update_reports(where: $where, _set: $changes) {
+				returning {
+					id
+					reporter_id
+					reported_id
+					message_id
+					category
+					details
+					evidence
+					status
+					assignee_id
+					resolution
+					created_at
+					updated_at
+				}
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"where": map[string]interface{}{
+				"id":     map[string]interface{}{"_eq": reportID},
+				"status": map[string]interface{}{"_neq": StatusResolved},
+			},
+			"changes": changes,
+		},
+	}
+	var responseData struct {
+		UpdateReports struct {
+			Returning []Report `json:"returning"`
+		} `json:"update_reports"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to update report: %w", err)
+	}
+	if len(responseData.UpdateReports.Returning) == 0 {
+		return nil, ErrReportResolved
+	}
+	switch action {
+	case ActionWarn:
+		if err := RecordWarning(Warning{UserID: report.ReportedID, ReportID: reportID, Category: report.Category, Note: note}); err != nil {
+			return nil, err
+		}
+		BroadcastWarning(report.ReportedID, report.Category, note)
+	case ActionSuspend:
+		if err := SetSuspended(ctx, report.ReportedID, true); err != nil {
+			if revertErr := revertResolution(*report); revertErr != nil {
+				log.Printf("Error reopening report %s after a failed suspension: %s", reportID, revertErr)
+			}
+			return nil, err
+		}
+	}
+	if err := RecordAction(ModerationAction{
+		ReportID:    &reportID,
+		ModeratorID: moderatorID,
+		Action:      action,
+		TargetID:    report.ReportedID,
+		Note:        note,
+	}); err != nil {
+		return nil, err
+	}
+	return &responseData.UpdateReports.Returning[0], nil
+}
+func revertResolution(report Report) error {
+	mutation := `
+		mutation RevertReport($id: uuid!, $changes: reports_set_input!) {
+			update_reports(where: {id: {_eq: $id}, status: {_eq: "resolved"}}, _set: $changes) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"id": report.ID,
+			"changes": map[string]interface{}{
+				"status":      report.Status,
+				"resolution":  report.Resolution,
+				"assignee_id": report.AssigneeID,
+				"updated_at":  time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to revert report: %w", err)
+	}
+	return nil
+}
+func SetSuspended(ctx context.Context, userID string, suspended bool) error {
+	mutation := `
+		mutation SetSuspended($userID: String!, $suspended: Boolean!) {
+			update_users_by_pk(pk_columns: {id: $userID}, _set: {suspended: $suspended}) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":    userID,
+			"suspended": suspended,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to update suspended flag: %w", err)
+	}
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	var err error
+	if suspended {
+		_, err = user.Ban(ctx, userID)
+	} else {
+		_, err = user.Unban(ctx, userID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update Clerk ban status: %w", err)
+	}
+	return nil
+}
+func RecordAction(action ModerationAction) error {
+	action.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	mutation := `
+		mutation InsertModerationAction($object: moderation_actions_insert_input!) {
+			insert_moderation_actions_one(object: $object) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": action,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	return nil
+}
+func GetModerationActions(reportID string) ([]ModerationAction, error) {
+	where := map[string]interface{}{}
+	if reportID != "" {
+		where["report_id"] = map[string]interface{}{"_eq": reportID}
+	}
+	query := `
+		query GetModerationActions($where: moderation_actions_bool_exp!) {
+			moderation_actions(where: $where, order_by: {created_at: desc}, limit: 200) {
+				report_id
+				moderator_id
+				action
+				target_id
+				note
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": where,
+		},
+	}
+	var responseData struct {
+		ModerationActions []ModerationAction `json:"moderation_actions"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get moderation actions: %w", err)
+	}
+	return responseData.ModerationActions, nil
+}
+func RecordWarning(warning Warning) error {
+	warning.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	mutation := `
+		mutation InsertModerationWarning($object: moderation_warnings_insert_input!) {
+			insert_moderation_warnings_one(object: $object) {
+				id
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": warning,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to record warning: %w", err)
+	}
+	return nil
+}
+func GetWarnings(userID string) ([]Warning, error) {
+	query := `
+		query GetWarnings($userID: String!) {
+			moderation_warnings(where: {user_id: {_eq: $userID}}, order_by: {created_at: desc}) {
+				id
+				user_id
+				report_id
+				category
+				note
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		ModerationWarnings []Warning `json:"moderation_warnings"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get warnings: %w", err)
+	}
+	return responseData.ModerationWarnings, nil
+}
+func BroadcastWarning(userID, category, note string) {
+	pusherID := os.Getenv("PUSHER_APP_ID")
+	pusherKey := os.Getenv("PUSHER_APP_KEY")
+	pusherSecret := os.Getenv("PUSHER_APP_SECRET")
+
+	pusherClient := pusher.Client{
+		AppID:   pusherID,
+		Key:     pusherKey,
+		Secret:  pusherSecret,
+		Cluster: "us2",
+		Secure:  true,
+	}
+	err := pusherClient.Trigger(fmt.Sprintf("notifications-%s", userID), "moderation-warning", map[string]string{
+		"category": category,
+		"note":     note,
+	})
+	if err != nil {
+		log.Println("Error sending moderation warning to Pusher:", err)
+	}
+}
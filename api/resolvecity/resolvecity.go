@@ -0,0 +1,205 @@
+package resolvecity
+
+import (
+	"api/hasura"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	EarthRadiusKm  = 6371.0
+	MaxSuggestions = 10
+)
+
+var DistanceBuckets = []float64{5, 10, 25, 50, 100, 250, 500}
+
+//go:embed cities.csv
+var gazetteerCSV string
+
+var gazetteer = loadGazetteer()
+
+type City struct {
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Latitude  float64 `json:"-"`
+	Longitude float64 `json:"-"`
+}
+
+type Location struct {
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+func (c City) String() string {
+	return c.Name + ", " + c.Country
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to resolve city")
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing q query parameter", http.StatusBadRequest)
+		return
+	}
+	suggestions := []string{}
+	for _, city := range Suggest(query) {
+		suggestions = append(suggestions, city.String())
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"cities": suggestions}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("City suggestions successfully created for %q", query)
+}
+func loadGazetteer() []City {
+	records, err := csv.NewReader(strings.NewReader(gazetteerCSV)).ReadAll()
+	if err != nil {
+		log.Printf("Error reading gazetteer: %s", err)
+		return nil
+	}
+	cities := []City{}
+	for _, record := range records[1:] {
+		if len(record) != 4 {
+			log.Printf("Skipping invalid gazetteer record: %v", record)
+			continue
+		}
+		latitude, latErr := strconv.ParseFloat(record[2], 64)
+		longitude, lonErr := strconv.ParseFloat(record[3], 64)
+		if latErr != nil || lonErr != nil {
+			log.Printf("Skipping invalid gazetteer record: %v", record)
+			continue
+		}
+		cities = append(cities, City{Name: record[0], Country: record[1], Latitude: latitude, Longitude: longitude})
+	}
+	return cities
+}
+func Suggest(query string) []City {
+	query = strings.ToLower(query)
+	matches := []City{}
+	for _, city := range gazetteer {
+		if strings.HasPrefix(strings.ToLower(city.String()), query) {
+			matches = append(matches, city)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].String() < matches[j].String()
+	})
+	if len(matches) > MaxSuggestions {
+		matches = matches[:MaxSuggestions]
+	}
+	return matches
+}
+func Resolve(name string) (*City, error) {
+	cityName, country, hasCountry := strings.Cut(name, ",")
+	cityName = strings.TrimSpace(cityName)
+	country = strings.TrimSpace(country)
+	matches := []City{}
+	for _, city := range gazetteer {
+		if strings.EqualFold(city.Name, cityName) && (!hasCountry || strings.EqualFold(city.Country, country)) {
+			matches = append(matches, city)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("unknown city %q", name)
+	}
+	if len(matches) > 1 {
+		options := make([]string, len(matches))
+		for i, city := range matches {
+			options[i] = city.String()
+		}
+		return nil, fmt.Errorf("ambiguous city %q, expected one of: %s", name, strings.Join(options, "; "))
+	}
+	return &matches[0], nil
+}
+func DistanceKm(aLat, aLon, bLat, bLon float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(bLat - aLat)
+	dLon := toRadians(bLon - aLon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(aLat))*math.Cos(toRadians(bLat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+func Bucket(distanceKm float64) string {
+	for _, limit := range DistanceBuckets {
+		if distanceKm <= limit {
+			return fmt.Sprintf("within %g km", limit)
+		}
+	}
+	return fmt.Sprintf("more than %g km", DistanceBuckets[len(DistanceBuckets)-1])
+}
+func GetLocations(userIDs []string) (map[string]Location, error) {
+	locations := make(map[string]Location, len(userIDs))
+	if len(userIDs) == 0 {
+		return locations, nil
+	}
+	query := `
+		query GetLocations($userIDs: [String!]!) {
+			users(where: {id: {_in: $userIDs}, latitude: {_is_null: false}, longitude: {_is_null: false}}) {
+				id
+				city
+				latitude
+				longitude
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userIDs": userIDs,
+		},
+	}
+	var responseData struct {
+		Users []struct {
+			ID        string  `json:"id"`
+			City      string  `json:"city"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get locations: %w", err)
+	}
+	for _, u := range responseData.Users {
+		locations[u.ID] = Location{City: u.City, Latitude: u.Latitude, Longitude: u.Longitude}
+	}
+	return locations, nil
+}
+func GetUserIDsWithin(origin Location, maxDistanceKm float64) ([]string, error) {
+	query := `
+		query GetLocatedUsers {
+			users(where: {latitude: {_is_null: false}, longitude: {_is_null: false}}) {
+				id
+				latitude
+				longitude
+			}
+		}
+	`
+	var responseData struct {
+		Users []struct {
+			ID        string  `json:"id"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"users"`
+	}
+	if err := hasura.Request(map[string]interface{}{"query": query}, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get located users: %w", err)
+	}
+	userIDs := []string{}
+	for _, u := range responseData.Users {
+		if DistanceKm(origin.Latitude, origin.Longitude, u.Latitude, u.Longitude) <= maxDistanceKm {
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+	return userIDs, nil
+}
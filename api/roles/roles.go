@@ -0,0 +1,94 @@
+package roles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+var StaffRoles = []string{RoleAdmin, RoleModerator}
+
+var (
+	ErrUnauthenticated = errors.New("session not found")
+	ErrForbidden       = errors.New("insufficient role")
+)
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for user role")
+	usr, err := Authorize(r)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		log.Printf("Error authorizing role request: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"user_id": usr.ID, "role": GetRole(usr)}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Role successfully retrieved")
+}
+func GetRole(usr *clerk.User) string {
+	var metadata struct {
+		Role string `json:"role"`
+	}
+	if usr == nil || len(usr.PublicMetadata) == 0 || json.Unmarshal(usr.PublicMetadata, &metadata) != nil {
+		return ""
+	}
+	return metadata.Role
+}
+func HasRole(usr *clerk.User, roles ...string) bool {
+	role := GetRole(usr)
+	if role == "" {
+		return false
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+func Authorize(r *http.Request, roles ...string) (*clerk.User, error) {
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user could not be retrieved from session", ErrUnauthenticated)
+	}
+	if len(roles) > 0 && !HasRole(usr, roles...) {
+		log.Printf("User %s with role %q attempted an action requiring %s", usr.ID, GetRole(usr), strings.Join(roles, " or "))
+		return nil, fmt.Errorf("%w: requires %s", ErrForbidden, strings.Join(roles, " or "))
+	}
+	return usr, nil
+}
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,572 @@
+package savedsearches
+
+import (
+	"api/blockuser"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+	"github.com/pusher/pusher-http-go/v5"
+)
+
+const (
+	MaxSavedSearches = 10
+	MaxNameLength    = 60
+	MaxKeywordLength = 100
+	DigestInterval   = 24 * time.Hour
+)
+
+type SavedSearch struct {
+	ID         string   `json:"id"`
+	UserID     string   `json:"user_id"`
+	Name       string   `json:"name"`
+	Languages  []string `json:"languages"`
+	Interests  []string `json:"interests"`
+	Specialty  string   `json:"specialty"`
+	Occupation string   `json:"occupation"`
+	Keywords   string   `json:"keywords"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type Profile struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Bio        string   `json:"bio"`
+	Language   []string `json:"language"`
+	Specialty  string   `json:"specialty"`
+	Interests  []string `json:"interests"`
+	Occupation string   `json:"occupation"`
+	Suspended  *bool    `json:"suspended,omitempty"`
+}
+
+type SearchMatch struct {
+	SearchID      string `json:"search_id"`
+	SearchName    string `json:"search_name"`
+	MatchedUserID string `json:"matched_user_id"`
+	MatchedName   string `json:"matched_name"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request for saved searches")
+	query := r.URL.Query()
+	if query.Get("operation") == "digest" {
+		cronSecret := os.Getenv("CRON_SECRET")
+		if cronSecret == "" || r.Header.Get("Authorization") != "Bearer "+cronSecret {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Printf("Saved search digest called without a valid cron secret")
+			return
+		}
+		sent, err := SendPendingDigests()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to send saved search digests: %s", err), http.StatusInternalServerError)
+			log.Printf("Error sending saved search digests: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"digests_sent": sent})
+		log.Printf("Saved search digests successfully sent to %d users", sent)
+		return
+	}
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	userID := query.Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		if query.Get("operation") == "matches" {
+			response, err = GetMatches(userID)
+		} else {
+			response, err = GetSavedSearches(userID)
+		}
+	case http.MethodPost:
+		var search SavedSearch
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON payload: %s", err), http.StatusBadRequest)
+			log.Printf("Error decoding JSON payload: %s", err)
+			return
+		}
+		search.UserID = userID
+		if err := ValidateSavedSearch(search); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid saved search: %s", err), http.StatusBadRequest)
+			return
+		}
+		response, err = CreateSavedSearch(search)
+	case http.MethodDelete:
+		searchID := query.Get("search_id")
+		if searchID == "" {
+			http.Error(w, "Missing search_id query parameter", http.StatusBadRequest)
+			return
+		}
+		err = DeleteSavedSearch(userID, searchID)
+		response = map[string]string{"status": "deleted"}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to do saved search operation: %s", err), http.StatusInternalServerError)
+		log.Printf("Error with saved search operation: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Saved search operation successfully completed")
+}
+func ValidateSavedSearch(search SavedSearch) error {
+	search.Name = strings.TrimSpace(search.Name)
+	if search.Name == "" || len(search.Name) > MaxNameLength {
+		return fmt.Errorf("name must be between 1 and %d characters", MaxNameLength)
+	}
+	if len(search.Keywords) > MaxKeywordLength {
+		return fmt.Errorf("keywords must be at most %d characters", MaxKeywordLength)
+	}
+	if len(search.Languages) == 0 && len(search.Interests) == 0 && search.Specialty == "" && search.Occupation == "" && strings.TrimSpace(search.Keywords) == "" {
+		return fmt.Errorf("at least one filter is required")
+	}
+	return nil
+}
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+}
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if strings.EqualFold(v, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+func Matches(search SavedSearch, profile Profile) bool {
+	if search.UserID == profile.ID {
+		return false
+	}
+	if len(search.Languages) > 0 && !containsAny(profile.Language, search.Languages) {
+		return false
+	}
+	if len(search.Interests) > 0 && !containsAny(profile.Interests, search.Interests) {
+		return false
+	}
+	if search.Specialty != "" && !strings.EqualFold(search.Specialty, profile.Specialty) {
+		return false
+	}
+	if search.Occupation != "" && !strings.EqualFold(search.Occupation, profile.Occupation) {
+		return false
+	}
+	if keywords := tokenize(search.Keywords); len(keywords) > 0 {
+		profileTokens := make(map[string]bool)
+		text := strings.Join(append(append([]string{profile.Name, profile.Bio, profile.Specialty, profile.Occupation}, profile.Language...), profile.Interests...), " ")
+		for _, token := range tokenize(text) {
+			profileTokens[token] = true
+		}
+		for _, keyword := range keywords {
+			if !profileTokens[keyword] {
+				return false
+			}
+		}
+	}
+	return true
+}
+func GetSavedSearches(userID string) ([]SavedSearch, error) {
+	query := `
+		query GetSavedSearches($userID: String!) {
+			saved_searches(where: {user_id: {_eq: $userID}}, order_by: {created_at: desc}) {
+				id
+				user_id
+				name
+				languages
+				interests
+				specialty
+				occupation
+				keywords
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		SavedSearches []SavedSearch `json:"saved_searches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	return responseData.SavedSearches, nil
+}
+func CreateSavedSearch(search SavedSearch) (*SavedSearch, error) {
+	existing, err := GetSavedSearches(search.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxSavedSearches {
+		return nil, fmt.Errorf("at most %d saved searches are allowed", MaxSavedSearches)
+	}
+	if search.Languages == nil {
+		search.Languages = []string{}
+	}
+	if search.Interests == nil {
+		search.Interests = []string{}
+	}
+	mutation := `
+		mutation CreateSavedSearch($object: saved_searches_insert_input!) {
+			insert_saved_searches_one(object: $object) {
+				id
+				user_id
+				name
+				languages
+				interests
+				specialty
+				occupation
+				keywords
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"object": map[string]interface{}{
+				"user_id":    search.UserID,
+				"name":       strings.TrimSpace(search.Name),
+				"languages":  search.Languages,
+				"interests":  search.Interests,
+				"specialty":  search.Specialty,
+				"occupation": search.Occupation,
+				"keywords":   strings.TrimSpace(search.Keywords),
+				"created_at": time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	var responseData struct {
+		InsertSavedSearchesOne SavedSearch `json:"insert_saved_searches_one"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to create saved search: %w", err)
+	}
+	return &responseData.InsertSavedSearchesOne, nil
+}
+func DeleteSavedSearch(userID, searchID string) error {
+	mutation := `
+		mutation DeleteSavedSearch($userID: String!, $searchID: uuid!) {
+			delete_saved_search_matches(where: {search_id: {_eq: $searchID}, owner_id: {_eq: $userID}}) {
+				affected_rows
+			}
+			delete_saved_searches(where: {id: {_eq: $searchID}, user_id: {_eq: $userID}}) {
+				affected_rows
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"userID":   userID,
+			"searchID": searchID,
+		},
+	}
+	var responseData struct {
+		DeleteSavedSearches struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_saved_searches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	if responseData.DeleteSavedSearches.AffectedRows == 0 {
+		return fmt.Errorf("no saved search found to delete")
+	}
+	return nil
+}
+func GetMatches(userID string) ([]SearchMatch, error) {
+	query := `
+		query GetSavedSearchMatches($userID: String!) {
+			saved_search_matches(where: {owner_id: {_eq: $userID}}, order_by: {created_at: desc}, limit: 50) {
+				search_id
+				search_name
+				matched_user_id
+				matched_name
+				created_at
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID": userID,
+		},
+	}
+	var responseData struct {
+		SavedSearchMatches []SearchMatch `json:"saved_search_matches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get saved search matches: %w", err)
+	}
+	return responseData.SavedSearchMatches, nil
+}
+func EvaluateProfile(userID string) error {
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return err
+	}
+	query := `
+		query GetProfileAndSearches($userID: String!, $excludedIDs: [String!]!) {
+			users_by_pk(id: $userID) {
+				id
+				name
+				bio
+				language
+				specialty
+				interests
+				occupation
+				suspended
+			}
+			matching_saved_searches(args: {profile_id: $userID}, where: {user_id: {_nin: $excludedIDs}}) {
+				id
+				user_id
+				name
+				languages
+				interests
+				specialty
+				occupation
+				keywords
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userID":      userID,
+			"excludedIDs": append(blockedIDs, userID),
+		},
+	}
+	var responseData struct {
+		User          *Profile      `json:"users_by_pk"`
+		SavedSearches []SavedSearch `json:"matching_saved_searches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	if responseData.User == nil || (responseData.User.Suspended != nil && *responseData.User.Suspended) {
+		return nil
+	}
+	profile := *responseData.User
+	matches := []map[string]interface{}{}
+	owners := make(map[string]bool)
+	for _, search := range responseData.SavedSearches {
+		if !Matches(search, profile) {
+			continue
+		}
+		matches = append(matches, map[string]interface{}{
+			"search_id":       search.ID,
+			"search_name":     search.Name,
+			"owner_id":        search.UserID,
+			"matched_user_id": profile.ID,
+			"matched_name":    profile.Name,
+			"created_at":      time.Now().Format(time.RFC3339Nano),
+		})
+		owners[search.UserID] = true
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	mutation := `
+		mutation InsertSavedSearchMatches($objects: [saved_search_matches_insert_input!]!) {
+			insert_saved_search_matches(
+				objects: $objects,
+				on_conflict: {constraint: saved_search_matches_search_id_matched_user_id_key, update_columns: []}
+			) {
+				affected_rows
+			}
+		}
+	`
+	requestBody = map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"objects": matches,
+		},
+	}
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to record saved search matches: %w", err)
+	}
+	for ownerID := range owners {
+		if _, err := SendDigest(ownerID); err != nil {
+			log.Printf("Error sending saved search digest to %s: %s", ownerID, err)
+		}
+	}
+	log.Printf("Profile %s matched %d saved searches", userID, len(matches))
+	return nil
+}
+func SendPendingDigests() (int, error) {
+	query := `
+		query GetPendingDigestOwners {
+			saved_search_matches(where: {notified_at: {_is_null: true}}, distinct_on: owner_id) {
+				owner_id
+			}
+		}
+	`
+	var responseData struct {
+		SavedSearchMatches []struct {
+			OwnerID string `json:"owner_id"`
+		} `json:"saved_search_matches"`
+	}
+	if err := hasura.Request(map[string]interface{}{"query": query}, &responseData); err != nil {
+		return 0, fmt.Errorf("failed to get pending digests: %w", err)
+	}
+	sent := 0
+	for _, m := range responseData.SavedSearchMatches {
+		ok, err := SendDigest(m.OwnerID)
+		if err != nil {
+			log.Printf("Error sending saved search digest to %s: %s", m.OwnerID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+func SendDigest(ownerID string) (bool, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	mutation := `
+		mutation SendDigest($ownerID: String!, $now: timestamptz!, $cutoff: timestamptz!) {
+			update_saved_search_digests(
+				where: {user_id: {_eq: $ownerID}, last_sent_at: {_lt: $cutoff}},
+				_set: {last_sent_at: $now}
+			) {
+				affected_rows
+			}
+			insert_saved_search_digests(
+				objects: {user_id: $ownerID, last_sent_at: $now},
+				on_conflict: {constraint: saved_search_digests_pkey, update_columns: []}
+			) {
+				affected_rows
+			}
+			update_saved_search_matches(
+				where: {
+					owner_id: {_eq: $ownerID},
+					notified_at: {_is_null: true},
+					_exists: {
+						_table: {schema: "public", name: "saved_search_digests"},
+						_where: {user_id: {_eq: $ownerID}, last_sent_at: {_eq: $now}}
+					}
+				},
+				_set: {notified_at: $now}
+			) {
+				returning {
+					search_id
+					search_name
+					matched_user_id
+					matched_name
+					created_at
+				}
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": mutation,
+		"variables": map[string]interface{}{
+			"ownerID": ownerID,
+			"now":     now.Format(time.RFC3339Nano),
+			"cutoff":  now.Add(-DigestInterval).Format(time.RFC3339Nano),
+		},
+	}
+	var responseData struct {
+		UpdateSavedSearchDigests struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_saved_search_digests"`
+		InsertSavedSearchDigests struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"insert_saved_search_digests"`
+		UpdateSavedSearchMatches struct {
+			Returning []SearchMatch `json:"returning"`
+		} `json:"update_saved_search_matches"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return false, fmt.Errorf("failed to send digest: %w", err)
+	}
+	if responseData.UpdateSavedSearchDigests.AffectedRows == 0 && responseData.InsertSavedSearchDigests.AffectedRows == 0 {
+		log.Printf("Saved search digest for %s throttled", ownerID)
+		return false, nil
+	}
+	matches := responseData.UpdateSavedSearchMatches.Returning
+	if len(matches) == 0 {
+		return false, nil
+	}
+	BroadcastDigest(ownerID, matches)
+	return true, nil
+}
+func BroadcastDigest(userID string, matches []SearchMatch) {
+	pusherID := os.Getenv("PUSHER_APP_ID")
+	pusherKey := os.Getenv("PUSHER_APP_KEY")
+	pusherSecret := os.Getenv("PUSHER_APP_SECRET")
+
+	pusherClient := pusher.Client{
+		AppID:   pusherID,
+		Key:     pusherKey,
+		Secret:  pusherSecret,
+		Cluster: "us2",
+		Secure:  true,
+	}
+	err := pusherClient.Trigger(
+		fmt.Sprintf("notifications-%s", userID),
+		"saved-search-digest",
+		map[string]interface{}{
+			"matches": matches,
+		},
+	)
+	if err != nil {
+		log.Printf("Error broadcasting saved search digest: %s", err)
+	} else {
+		log.Printf("Saved search digest sent to %s", userID)
+	}
+}
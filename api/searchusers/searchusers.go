@@ -0,0 +1,283 @@
+package searchusers
+
+import (
+	"api/blockuser"
+	"api/getusers"
+	"api/hasura"
+	"api/updateseen"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+const (
+	MaxQueryLength     = 100
+	ScoreScale         = 100
+	MatchedTokenWeight = 1000000
+	MaxCandidates      = 500
+)
+
+var FieldWeights = map[string]float64{
+	"name":       3,
+	"language":   2.5,
+	"interests":  2,
+	"specialty":  2,
+	"occupation": 1.5,
+	"bio":        1,
+}
+
+type posting struct {
+	doc    int
+	weight float64
+}
+
+type Index struct {
+	users    []getusers.User
+	postings map[string][]posting
+}
+
+type Result struct {
+	User    getusers.User
+	Matched int
+	Score   float64
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received request to search users in Hasura")
+	clerk.SetKey(os.Getenv("NUXT_CLERK_SECRET_KEY"))
+	sessionToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: sessionToken,
+	})
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusUnauthorized)
+		log.Printf("Session not found")
+		return
+	}
+	usr, err := user.Get(r.Context(), claims.Subject)
+	if err != nil {
+		http.Error(w, "User could not be retrieved from session", http.StatusUnauthorized)
+		log.Printf("User could not be retrieved from session")
+		return
+	}
+	log.Printf("Found user %s", usr.ID)
+
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if userID == "" || searchQuery == "" {
+		http.Error(w, "Missing user_id or q query parameter", http.StatusBadRequest)
+		return
+	}
+	if len(searchQuery) > MaxQueryLength {
+		http.Error(w, fmt.Sprintf("Query must be at most %d characters", MaxQueryLength), http.StatusBadRequest)
+		return
+	}
+	if userID != usr.ID {
+		http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, userID)
+		return
+	}
+	limit, err := getusers.ParsePageSize(query.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor, err := getusers.DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor query parameter", http.StatusBadRequest)
+		log.Printf("Error decoding cursor: %s", err)
+		return
+	}
+	updateseen.UpdateUserInHasura(userID)
+
+	users, err := GetSearchableUsers(userID, searchQuery)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get users: %s", err), http.StatusInternalServerError)
+		log.Printf("Error getting users: %s", err)
+		return
+	}
+	results := NewIndex(users).Search(searchQuery)
+	rankedUsers := make([]getusers.User, len(results))
+	for i, result := range results {
+		rankedUsers[i] = result.User
+		rankedUsers[i].SimilarityScore = int64(result.Matched)*MatchedTokenWeight + int64(result.Score*ScoreScale)
+		rankedUsers[i].MatchScore = float64(rankedUsers[i].SimilarityScore)
+	}
+	page := getusers.PageUsers(rankedUsers, cursor, limit)
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create response JSON: %s", err), http.StatusInternalServerError)
+		log.Printf("Error creating response JSON: %s", err)
+		return
+	}
+	log.Printf("Search for %q successfully returned %d users", searchQuery, len(results))
+}
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+}
+func NewIndex(users []getusers.User) *Index {
+	index := &Index{users: users, postings: make(map[string][]posting)}
+	for i, u := range users {
+		weights := make(map[string]float64)
+		add := func(field, text string) {
+			for _, token := range Tokenize(text) {
+				if FieldWeights[field] > weights[token] {
+					weights[token] = FieldWeights[field]
+				}
+			}
+		}
+		add("name", u.Name)
+		add("language", strings.Join(u.Language, " "))
+		add("interests", strings.Join(u.Interests, " "))
+		add("specialty", u.Specialty)
+		add("occupation", u.Occupation)
+		add("bio", u.Bio)
+		for token, weight := range weights {
+			index.postings[token] = append(index.postings[token], posting{doc: i, weight: weight})
+		}
+	}
+	return index
+}
+func MaxEdits(token string) int {
+	length := len([]rune(token))
+	if length <= 3 {
+		return 0
+	} else if length <= 6 {
+		return 1
+	}
+	return 2
+}
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+func termSimilarity(queryToken, term string) float64 {
+	if queryToken == term {
+		return 1
+	}
+	if len(queryToken) >= 2 && strings.HasPrefix(term, queryToken) {
+		return 0.8
+	}
+	maxEdits := MaxEdits(queryToken)
+	if maxEdits == 0 {
+		return 0
+	}
+	lengthDiff := len([]rune(term)) - len([]rune(queryToken))
+	if lengthDiff > maxEdits || -lengthDiff > maxEdits {
+		return 0
+	}
+	distance := EditDistance(queryToken, term)
+	if distance > maxEdits {
+		return 0
+	}
+	return 0.7 - 0.2*float64(distance-1)
+}
+func (index *Index) Search(query string) []Result {
+	scores := make(map[int]*Result)
+	for _, queryToken := range Tokenize(query) {
+		best := make(map[int]float64)
+		for term, postings := range index.postings {
+			similarity := termSimilarity(queryToken, term)
+			if similarity == 0 {
+				continue
+			}
+			for _, p := range postings {
+				if score := similarity * p.weight; score > best[p.doc] {
+					best[p.doc] = score
+				}
+			}
+		}
+		for doc, score := range best {
+			result, ok := scores[doc]
+			if !ok {
+				result = &Result{User: index.users[doc]}
+				scores[doc] = result
+			}
+			result.Matched++
+			result.Score += score
+		}
+	}
+	results := make([]Result, 0, len(scores))
+	for _, result := range scores {
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Matched != results[j].Matched {
+			return results[i].Matched > results[j].Matched
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].User.ID < results[j].User.ID
+	})
+	return results
+}
+func GetSearchableUsers(userID, searchQuery string) ([]getusers.User, error) {
+	tokens := Tokenize(searchQuery)
+	if len(tokens) == 0 {
+		return []getusers.User{}, nil
+	}
+	blockedIDs, err := blockuser.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		query GetSearchCandidates($search: String!, $excludedIDs: [String!]!, $limit: Int!) {
+			search_users(args: {search: $search}, where: {id: {_nin: $excludedIDs}}, order_by: [{similarity_score: desc}, {id: asc}], limit: $limit) {
+				id
+				name
+				email
+				bio
+				language
+				specialty
+				interests
+				occupation
+				profile_picture
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"search":      strings.Join(tokens, " "),
+			"excludedIDs": append(blockedIDs, userID),
+			"limit":       MaxCandidates,
+		},
+	}
+	var responseData struct {
+		Users []getusers.User `json:"search_users"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get search candidates: %w", err)
+	}
+	return responseData.Users, nil
+}
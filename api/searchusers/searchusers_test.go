@@ -0,0 +1,127 @@
+package searchusers
+
+import (
+	"api/getusers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("C++ and C#, Go-lang!  Rust")
+	want := []string{"c++", "and", "c#", "go", "lang", "rust"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tokenize() = %v, want %v", got, want)
+	}
+	if got := Tokenize(" -- "); len(got) != 0 {
+		t.Fatalf("expected no tokens for punctuation only, got %v", got)
+	}
+}
+func TestMaxEdits(t *testing.T) {
+	cases := map[string]int{"go": 0, "sql": 0, "rust": 1, "python": 1, "haskell": 2, "javascript": 2}
+	for token, want := range cases {
+		if got := MaxEdits(token); got != want {
+			t.Errorf("MaxEdits(%q) = %d, want %d", token, got, want)
+		}
+	}
+}
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"python", "python", 0},
+		{"pythn", "python", 1},
+		{"javascirpt", "javascript", 2},
+		{"", "go", 2},
+	}
+	for _, c := range cases {
+		if got := EditDistance(c.a, c.b); got != c.want {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+func resultIDs(results []Result) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.User.ID
+	}
+	return ids
+}
+func TestSearchTypoTolerance(t *testing.T) {
+	index := NewIndex([]getusers.User{
+		{ID: "1", Name: "Ada", Language: []string{"Python"}},
+		{ID: "2", Name: "Linus", Language: []string{"JavaScript"}},
+		{ID: "3", Name: "Grace", Language: []string{"Go"}},
+	})
+	cases := map[string][]string{
+		"pythn":      {"1"},
+		"javascirpt": {"2"},
+		"jav":        {"2"},
+		"go":         {"3"},
+		"gp":         {},
+		"pyhtonn":    {},
+	}
+	for query, want := range cases {
+		if got := resultIDs(index.Search(query)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+func TestSearchRanking(t *testing.T) {
+	index := NewIndex([]getusers.User{
+		{ID: "1", Name: "Ada", Bio: "I like rust"},
+		{ID: "2", Name: "Linus", Language: []string{"Rust"}},
+		{ID: "3", Name: "Grace", Language: []string{"Rust"}, Specialty: "Backend"},
+		{ID: "4", Name: "Rust", Bio: "Frontend"},
+		{ID: "5", Name: "Ken", Language: []string{"Rustlang"}},
+	})
+	got := resultIDs(index.Search("rust backend"))
+	want := []string{"3", "4", "2", "5", "1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Search() ranking = %v, want %v", got, want)
+	}
+}
+func TestGetSearchableUsersPrefiltersInPostgres(t *testing.T) {
+	var variables map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(body.Query, "GetBlockedIDs"):
+			w.Write([]byte(`{"data":{"blocked":[{"target_id":"blocked_user"}],"blockedBy":[]}}`))
+		case strings.Contains(body.Query, "search_users"):
+			variables = body.Variables
+			w.Write([]byte(`{"data":{"search_users":[{"id":"candidate","name":"Ada"}]}}`))
+		default:
+			w.Write([]byte(`{"errors":[{"message":"unexpected query"}]}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("HASURA_GRAPHQL_URL", server.URL)
+	t.Setenv("HASURA_GRAPHQL_ADMIN_SECRET", "test")
+
+	users, err := GetSearchableUsers("searcher", "Rust, Backend!")
+	if err != nil {
+		t.Fatalf("GetSearchableUsers() error = %s", err)
+	}
+	if len(users) != 1 || users[0].ID != "candidate" {
+		t.Fatalf("GetSearchableUsers() = %+v, want the candidate returned by Postgres", users)
+	}
+	if variables["search"] != "rust backend" {
+		t.Errorf("search = %v, want the tokenized query", variables["search"])
+	}
+	if got, want := variables["excludedIDs"], []interface{}{"blocked_user", "searcher"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("excludedIDs = %v, want %v", got, want)
+	}
+	if variables["limit"] != float64(MaxCandidates) {
+		t.Errorf("limit = %v, want %d", variables["limit"], MaxCandidates)
+	}
+}
@@ -2,6 +2,8 @@ package sendmessage
 
 import (
 	"api/addfriend"
+	"api/blockuser"
+	"api/messagerequests"
 	"api/updateseen"
 	"bytes"
 	"crypto/aes"
@@ -10,6 +12,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,6 +29,8 @@ import (
 	"github.com/pusher/pusher-http-go/v5"
 )
 
+var ErrCallNotAllowed = errors.New("calls are only allowed between friends or after a message request is accepted")
+
 type Message struct {
 	SenderID      string `json:"sender_id"`
 	ReceiverEmail string `json:"receiver_email"`
@@ -38,6 +43,7 @@ type MessagePusher struct {
 	EncryptedContent string `json:"encrypted_content"`
 	Key              string `json:"key"`
 	CreatedAt        string `json:"created_at"`
+	System           bool   `json:"system,omitempty"`
 }
 type VoiceCall struct {
 	CallerID   string `json:"caller_id"`
@@ -123,6 +129,27 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Error getting receiver ID: %s", err)
 			return
 		}
+		if blocked, err := blockuser.IsBlocked(msg.SenderID, receiverID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check block list: %s", err), http.StatusInternalServerError)
+			log.Printf("Error checking block list: %s", err)
+			return
+		} else if blocked {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+			log.Printf("Dropped message from %s to blocked user %s", msg.SenderID, receiverID)
+			return
+		}
+		route, err := messagerequests.Route(msg.SenderID, receiverID)
+		if errors.Is(err, messagerequests.ErrFriendshipRequired) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to route message: %s", err), http.StatusInternalServerError)
+			log.Printf("Error routing message: %s", err)
+			return
+		}
 		serverSecret := os.Getenv("ENCRYPTION_KEY")
 		encryptionKey := GenerateEncryptionKey(msg.SenderID, serverSecret)
 		encryptedContent, iv, err := EncryptMessage(msg.Content, encryptionKey)
@@ -131,20 +158,37 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Error encrypting message: %s", err)
 			return
 		}
-		BroadcastMessage(MessagePusher{
-			SenderID:         msg.SenderID,
-			RecipientID:      receiverID,
-			EncryptedContent: msg.Content,
-			CreatedAt:        time.Now().Format(time.RFC3339Nano),
-		})
+		if route == messagerequests.RouteDirect {
+			BroadcastMessage(MessagePusher{
+				SenderID:         msg.SenderID,
+				RecipientID:      receiverID,
+				EncryptedContent: msg.Content,
+				CreatedAt:        time.Now().Format(time.RFC3339Nano),
+			})
+		}
 		msg.Content = encryptedContent
 		msg.Key = iv
-		if err := InsertMessage(msg.SenderID, receiverID, msg.Content, msg.Key); err != nil {
+		if route == messagerequests.RouteDirect {
+			err = InsertMessage(msg.SenderID, receiverID, msg.Content, msg.Key)
+		} else {
+			err = StoreMessage(msg.SenderID, receiverID, msg.Content, msg.Key)
+		}
+		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to insert message: %s", err), http.StatusInternalServerError)
 			log.Printf("Error inserting message: %s", err)
 			return
 		}
+		if route == messagerequests.RouteRequest {
+			if muted, err := blockuser.IsMuted(receiverID, msg.SenderID); err != nil {
+				log.Printf("Error checking mute for %s: %s", receiverID, err)
+			} else if !muted {
+				messagerequests.BroadcastMessageRequest(receiverID, msg.SenderID)
+			}
+		}
 		response := map[string]string{"status": "success"}
+		if route != messagerequests.RouteDirect {
+			response["status"] = "requested"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(response)
@@ -157,45 +201,51 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Invalid VoiceCall payload: %v", payload)
 			return
 		}
+		actorID, otherID := voicecall.CallerID, voicecall.CalleeID
+		if voicecall.Type == "decline" || voicecall.Type == "taken" {
+			actorID, otherID = voicecall.CalleeID, voicecall.CallerID
+		}
+		if actorID != usr.ID {
+			http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
+			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, actorID)
+			return
+		}
+		route, err := CallRoute(actorID, otherID)
+		if errors.Is(err, ErrCallNotAllowed) || errors.Is(err, messagerequests.ErrFriendshipRequired) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to route call: %s", err), http.StatusInternalServerError)
+			log.Printf("Error routing call: %s", err)
+			return
+		}
+		if route == messagerequests.RouteIgnored {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "call request sent"})
+			log.Printf("Dropped call signal between blocked users %s and %s", voicecall.CallerID, voicecall.CalleeID)
+			return
+		}
 		if voicecall.Type == "decline" {
-			if voicecall.CalleeID != usr.ID {
-				http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
-				log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, voicecall.CalleeID)
-				return
-			}
 			BroadcastDecline(voicecall)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"status": "call declined"})
 			return
 		} else if voicecall.Type == "cancel" {
-			if voicecall.CallerID != usr.ID {
-				http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
-				log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, voicecall.CallerID)
-				return
-			}
 			BroadcastCancel(voicecall)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"status": "call declined"})
 			return
 		} else if voicecall.Type == "taken" {
-			if voicecall.CalleeID != usr.ID {
-				http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
-				log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, voicecall.CalleeID)
-				return
-			}
 			BroadcastTaken(voicecall)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"status": "call already taken, declined"})
 			return
 		}
-		if voicecall.CallerID != usr.ID {
-			http.Error(w, "JWT subject does not match request ID", http.StatusForbidden)
-			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, voicecall.CallerID)
-			return
-		}
 
 		BroadcastVoiceCall(voicecall)
 		w.Header().Set("Content-Type", "application/json")
@@ -214,6 +264,23 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, message.UserID)
 			return
 		}
+		route, err := CallRoute(message.UserID, message.RecipientID)
+		if errors.Is(err, ErrCallNotAllowed) || errors.Is(err, messagerequests.ErrFriendshipRequired) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to route WebRTC message: %s", err), http.StatusInternalServerError)
+			log.Printf("Error routing WebRTC message: %s", err)
+			return
+		}
+		if route == messagerequests.RouteIgnored {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "webrtc message sent"})
+			log.Printf("Dropped WebRTC message from %s to blocked user %s", message.UserID, message.RecipientID)
+			return
+		}
 		log.Printf("Sending WebRTC message: %v", message)
 		BroadcastWebRTCMessage(fmt.Sprintf("private-call-%s", message.RecipientID), message)
 		w.Header().Set("Content-Type", "application/json")
@@ -224,15 +291,54 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Unknown payload type: %v", payload)
 	}
 }
+func CallRoute(userID, otherID string) (string, error) {
+	blocked, err := blockuser.IsBlocked(userID, otherID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check block list: %w", err)
+	}
+	if blocked {
+		return messagerequests.RouteIgnored, nil
+	}
+	route, err := messagerequests.Route(userID, otherID)
+	if err != nil {
+		return "", err
+	}
+	if route != messagerequests.RouteDirect {
+		return "", ErrCallNotAllowed
+	}
+	return route, nil
+}
 func payloadToJSON(payload map[string]interface{}) string {
 	jsonData, _ := json.Marshal(payload)
 	return string(jsonData)
 }
 func InsertMessage(senderID, retrieverID, content, key string) error {
+	if err := StoreMessage(senderID, retrieverID, content, key); err != nil {
+		return err
+	}
+	if muted, err := blockuser.IsMuted(retrieverID, senderID); err != nil {
+		log.Printf("Error checking mute for %s: %s", retrieverID, err)
+	} else if muted {
+		return nil
+	}
+	err := UpdateNotifications(retrieverID, senderID)
+	if err != nil {
+		return fmt.Errorf("failed to update notifications: %w", err)
+	}
+	BroadcastNotification(retrieverID, senderID)
+	return nil
+}
+func StoreMessage(senderID, retrieverID, content, key string) error {
+	return storeMessage(senderID, retrieverID, content, key, false)
+}
+func StoreSystemMessage(senderID, retrieverID, content, key string) error {
+	return storeMessage(senderID, retrieverID, content, key, true)
+}
+func storeMessage(senderID, retrieverID, content, key string, system bool) error {
 	createdAt := time.Now().Format(time.RFC3339Nano)
 	query := `
-		mutation InsertMessages($senderID: String!, $recipientID: String!, $content: String!, $key: String!, $createdAt: timestamptz!) {
-			insert_messages(objects: {sender_id: $senderID, recipient_id: $recipientID, encrypted_content: $content, key: $key, created_at: $createdAt}) {
+		mutation InsertMessages($senderID: String!, $recipientID: String!, $content: String!, $key: String!, $createdAt: timestamptz!, $system: Boolean!) {
+			insert_messages(objects: {sender_id: $senderID, recipient_id: $recipientID, encrypted_content: $content, key: $key, created_at: $createdAt, system: $system}) {
 				affected_rows
 			}
 		}
@@ -244,6 +350,7 @@ func InsertMessage(senderID, retrieverID, content, key string) error {
 		"content":     content,
 		"key":         key,
 		"createdAt":   createdAt,
+		"system":      system,
 	}
 
 	requestBody := map[string]interface{}{
@@ -293,11 +400,6 @@ func InsertMessage(senderID, retrieverID, content, key string) error {
 	}
 
 	log.Printf("Sent message in Hasura")
-	err = UpdateNotifications(retrieverID, senderID)
-	if err != nil {
-		return fmt.Errorf("failed to update notifications: %w", err)
-	}
-	BroadcastNotification(retrieverID, senderID)
 	return nil
 }
 func UpdateNotifications(userID, senderID string) error {
@@ -381,6 +483,7 @@ func BroadcastMessage(message MessagePusher) {
 		"recipient_id":      message.RecipientID,
 		"encrypted_content": message.EncryptedContent,
 		"created_at":        message.CreatedAt,
+		"system":            message.System,
 	}
 
 	err := pusherClient.Trigger(channelName, "new-message", data)
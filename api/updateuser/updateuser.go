@@ -1,12 +1,18 @@
 package updateuser
 
 import (
-	"bytes"
+	"api/auditlog"
+	"api/getoverlap"
+	"api/hasura"
+	"api/resolvecity"
+	"api/savedsearches"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,13 +21,50 @@ import (
 	"github.com/clerk/clerk-sdk-go/v2/user"
 )
 
+const (
+	MaxYearsOfExperience = 60
+	PeerLevelAny         = "any"
+	PeerLevelSame        = "same"
+	PeerLevelExperienced = "more_experienced"
+	MentorshipOffer      = "offer"
+	MentorshipSeek       = "seek"
+)
+
+var ProficiencyLevels = []string{"beginner", "intermediate", "advanced", "expert"}
+
+type LanguageSkill struct {
+	Language string `json:"language"`
+	Level    string `json:"level"`
+	Years    int    `json:"years"`
+}
+
+type Mentorship struct {
+	Role        string   `json:"role"`
+	Languages   []string `json:"languages"`
+	Specialties []string `json:"specialties"`
+}
+
+type SkillProfile struct {
+	Proficiency []LanguageSkill `json:"proficiency"`
+	PeerLevel   string          `json:"peer_level"`
+	Specialty   string          `json:"specialty"`
+	Mentorship  Mentorship      `json:"mentorship"`
+}
+
 type UpdateUserRequest struct {
-	ID         string   `json:"id"`
-	Bio        string   `json:"bio"`
-	Language   []string `json:"language"`
-	Specialty  string   `json:"specialty"`
-	Interests  []string `json:"interests"`
-	Occupation string   `json:"occupation"`
+	ID           string                           `json:"id"`
+	Bio          string                           `json:"bio"`
+	Language     []string                         `json:"language"`
+	Specialty    string                           `json:"specialty"`
+	Interests    []string                         `json:"interests"`
+	Occupation   string                           `json:"occupation"`
+	Timezone     *string                          `json:"timezone,omitempty"`
+	Availability *[]getoverlap.AvailabilityWindow `json:"availability,omitempty"`
+	Proficiency  *[]LanguageSkill                 `json:"proficiency,omitempty"`
+	PeerLevel    *string                          `json:"peer_level,omitempty"`
+	Mentorship   *Mentorship                      `json:"mentorship,omitempty"`
+	CoffeeChat   *bool                            `json:"coffee_chat_opt_in,omitempty"`
+	City         *string                          `json:"city,omitempty"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -55,11 +98,35 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("JWT subject (%s) does not match request ID (%s)", usr.ID, updateReq.ID)
 		return
 	}
+	if updateReq.Availability != nil && updateReq.Timezone == nil {
+		schedules, err := getoverlap.GetSchedules([]string{updateReq.ID})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get stored schedule: %s", err), http.StatusInternalServerError)
+			log.Printf("Error getting stored schedule: %s", err)
+			return
+		}
+		if timezone := schedules[updateReq.ID].Timezone; timezone != "" {
+			updateReq.Timezone = &timezone
+		}
+	}
+	if err := ValidateUpdateUserRequest(updateReq); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid profile: %s", err), http.StatusBadRequest)
+		log.Printf("Error validating profile: %s", err)
+		return
+	}
+	changed, err := ChangedFields(updateReq)
+	if err != nil {
+		log.Printf("Error comparing profile changes: %s", err)
+	}
 	if err := UpdateUserInHasura(updateReq); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update user in Hasura: %s", err), http.StatusInternalServerError)
 		log.Printf("Error updating user in Hasura: %s", err)
 		return
 	}
+	auditlog.Record(r, usr.ID, "profile.update", updateReq.ID, map[string]interface{}{"changed": changed})
+	if err := savedsearches.EvaluateProfile(updateReq.ID); err != nil {
+		log.Printf("Error evaluating saved searches: %s", err)
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]string{"status": "success"}
@@ -72,64 +139,385 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("User with ID %s successfully updated in Hasura", updateReq.ID)
 }
+func ValidateUpdateUserRequest(req UpdateUserRequest) error {
+	if req.Timezone != nil || req.Availability != nil {
+		schedule := getoverlap.Schedule{}
+		if req.Timezone != nil {
+			schedule.Timezone = *req.Timezone
+		}
+		if req.Availability != nil {
+			schedule.Availability = *req.Availability
+		}
+		if err := getoverlap.ValidateSchedule(schedule); err != nil {
+			return err
+		}
+	}
+	if req.Proficiency != nil {
+		languages := make(map[string]bool, len(req.Language))
+		for _, language := range req.Language {
+			languages[language] = true
+		}
+		seen := make(map[string]bool, len(*req.Proficiency))
+		for _, skill := range *req.Proficiency {
+			if !languages[skill.Language] {
+				return fmt.Errorf("proficiency given for %q, which is not in the language list", skill.Language)
+			}
+			if seen[skill.Language] {
+				return fmt.Errorf("proficiency for %q is listed more than once", skill.Language)
+			}
+			seen[skill.Language] = true
+			if LevelRank(skill.Level) == 0 {
+				return fmt.Errorf("invalid level %q for %s, expected one of %s", skill.Level, skill.Language, strings.Join(ProficiencyLevels, ", "))
+			}
+			if skill.Years < 0 || skill.Years > MaxYearsOfExperience {
+				return fmt.Errorf("years of experience for %s must be between 0 and %d", skill.Language, MaxYearsOfExperience)
+			}
+		}
+	}
+	if req.City != nil && strings.TrimSpace(*req.City) != "" {
+		if _, err := resolvecity.Resolve(*req.City); err != nil {
+			return err
+		}
+	}
+	if req.PeerLevel != nil {
+		switch *req.PeerLevel {
+		case PeerLevelAny, PeerLevelSame, PeerLevelExperienced:
+		default:
+			return fmt.Errorf("invalid peer_level %q, expected %s, %s or %s", *req.PeerLevel, PeerLevelAny, PeerLevelSame, PeerLevelExperienced)
+		}
+	}
+	if req.Mentorship != nil {
+		switch req.Mentorship.Role {
+		case "":
+		case MentorshipOffer:
+			languages := make(map[string]bool, len(req.Language))
+			for _, language := range req.Language {
+				languages[language] = true
+			}
+			for _, language := range req.Mentorship.Languages {
+				if !languages[language] {
+					return fmt.Errorf("cannot offer mentorship in %q, which is not in the language list", language)
+				}
+			}
+			fallthrough
+		case MentorshipSeek:
+			if len(req.Mentorship.Languages) == 0 && len(req.Mentorship.Specialties) == 0 {
+				return fmt.Errorf("mentorship requires at least one language or specialty")
+			}
+		default:
+			return fmt.Errorf("invalid mentorship role %q, expected %s or %s", req.Mentorship.Role, MentorshipOffer, MentorshipSeek)
+		}
+	}
+	return nil
+}
+func LevelRank(level string) int {
+	for i, l := range ProficiencyLevels {
+		if l == level {
+			return i + 1
+		}
+	}
+	return 0
+}
+func ProfileComplete(req UpdateUserRequest) bool {
+	return strings.TrimSpace(req.Bio) != "" && req.Occupation != "" && (len(req.Language) > 0 || len(req.Interests) > 0 || req.Specialty != "")
+}
+func ChangedFields(req UpdateUserRequest) ([]string, error) {
+	requested := map[string]interface{}{
+		"bio":        req.Bio,
+		"language":   req.Language,
+		"specialty":  req.Specialty,
+		"interests":  req.Interests,
+		"occupation": req.Occupation,
+	}
+	if req.Timezone != nil {
+		requested["timezone"] = *req.Timezone
+	}
+	if req.Availability != nil {
+		requested["availability"] = *req.Availability
+	}
+	if req.Proficiency != nil {
+		requested["proficiency"] = *req.Proficiency
+	}
+	if req.PeerLevel != nil {
+		requested["peer_level"] = *req.PeerLevel
+	}
+	if req.Mentorship != nil {
+		requested["mentorship"] = *req.Mentorship
+	}
+	if req.CoffeeChat != nil {
+		requested["coffee_chat_opt_in"] = *req.CoffeeChat
+	}
+	if req.City != nil {
+		requested["city"] = nil
+		if strings.TrimSpace(*req.City) != "" {
+			if city, err := resolvecity.Resolve(*req.City); err == nil {
+				requested["city"] = city.String()
+			}
+		}
+	}
+	query := `
+		query GetProfile($id: String!) {
+			users_by_pk(id: $id) {
+				bio
+				language
+				specialty
+				interests
+				occupation
+				timezone
+				availability
+				proficiency
+				peer_level
+				mentorship
+				coffee_chat_opt_in
+				city
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"id": req.ID,
+		},
+	}
+	var responseData struct {
+		UsersByPk map[string]interface{} `json:"users_by_pk"`
+	}
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+	changed := []string{}
+	for field, value := range requested {
+		if !sameValue(value, responseData.UsersByPk[field]) {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+func sameValue(requested, stored interface{}) bool {
+	jsonValue, err := json.Marshal(requested)
+	if err != nil {
+		return false
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(jsonValue, &normalized); err != nil {
+		return false
+	}
+	if isEmpty(normalized) && isEmpty(stored) {
+		return true
+	}
+	return reflect.DeepEqual(normalized, stored)
+}
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
 func UpdateUserInHasura(req UpdateUserRequest) error {
 	query := `
-		mutation UpdateUser($id: String!, $bio: String, $language: [String!], $specialty: String, $interests: [String!], $occupation: String, $lastSeen: timestamptz!) {
+		mutation UpdateUser($id: String!, $changes: users_set_input!) {
 			update_users_by_pk(
 				pk_columns: {id: $id},
-				_set: {bio: $bio, language: $language, specialty: $specialty, interests: $interests, occupation: $occupation, last_seen: $lastSeen}
+				_set: $changes
 				){
 					id
-					bio
-					language
-					specialty
-					interests
-					occupation
 				}
 		}
 	`
-	variables := map[string]interface{}{
-		"id":         req.ID,
+	if ProfileComplete(req) {
+		query = `
+			mutation UpdateUserAndOnboard($id: String!, $changes: users_set_input!, $now: timestamptz!) {
+				update_users_by_pk(
+					pk_columns: {id: $id},
+					_set: $changes
+					){
+						id
+					}
+				update_users(
+					where: {id: {_eq: $id}, _or: [{onboarded: {_is_null: true}}, {onboarded: {_eq: false}}]},
+					_set: {onboarded: true, onboarded_at: $now}
+				) {
+					affected_rows
+				}
+			}
+		`
+	}
+	changes := map[string]interface{}{
 		"bio":        req.Bio,
 		"language":   req.Language,
 		"specialty":  req.Specialty,
 		"interests":  req.Interests,
 		"occupation": req.Occupation,
-		"lastSeen":   time.Now().Format(time.RFC3339Nano),
+		"last_seen":  time.Now().Format(time.RFC3339Nano),
+	}
+	if req.Timezone != nil {
+		changes["timezone"] = *req.Timezone
+	}
+	if req.Availability != nil {
+		changes["availability"] = *req.Availability
+	}
+	if req.Proficiency != nil {
+		changes["proficiency"] = *req.Proficiency
+	}
+	if req.PeerLevel != nil {
+		changes["peer_level"] = *req.PeerLevel
+	}
+	if req.Mentorship != nil {
+		changes["mentorship"] = *req.Mentorship
+	}
+	if req.CoffeeChat != nil {
+		changes["coffee_chat_opt_in"] = *req.CoffeeChat
+	}
+	if req.City != nil {
+		changes["city"] = nil
+		changes["latitude"] = nil
+		changes["longitude"] = nil
+		if strings.TrimSpace(*req.City) != "" {
+			city, err := resolvecity.Resolve(*req.City)
+			if err != nil {
+				return fmt.Errorf("failed to resolve city: %w", err)
+			}
+			changes["city"] = city.String()
+			changes["latitude"] = city.Latitude
+			changes["longitude"] = city.Longitude
+		}
+	}
+	variables := map[string]interface{}{
+		"id":      req.ID,
+		"changes": changes,
+	}
+	if ProfileComplete(req) {
+		variables["now"] = changes["last_seen"]
 	}
 	requestBody := map[string]interface{}{
 		"query":     query,
 		"variables": variables,
 	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON request body: %w", err)
+	if err := hasura.Request(requestBody, nil); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
 	}
-
-	hasuraURL := os.Getenv("HASURA_GRAPHQL_URL")
-	hasuraSecret := os.Getenv("HASURA_GRAPHQL_ADMIN_SECRET")
-
-	reqBody, err := http.NewRequest("POST", hasuraURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	return nil
+}
+func GetSkillProfiles(userIDs []string) (map[string]SkillProfile, error) {
+	profiles := make(map[string]SkillProfile, len(userIDs))
+	if len(userIDs) == 0 {
+		return profiles, nil
 	}
-
-	reqBody.Header.Set("Content-Type", "application/json")
-	reqBody.Header.Set("x-hasura-admin-secret", hasuraSecret)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to send request to Hasura: %w", err)
+	query := `
+		query GetSkillProfiles($userIDs: [String!]!) {
+			users(where: {id: {_in: $userIDs}}) {
+				id
+				language
+				specialty
+				proficiency
+				peer_level
+				mentorship
+			}
+		}
+	`
+	requestBody := map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"userIDs": userIDs,
+		},
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("hasura responded with status: %s", resp.Status)
+	var responseData struct {
+		Users []struct {
+			ID          string          `json:"id"`
+			Language    []string        `json:"language"`
+			Proficiency []LanguageSkill `json:"proficiency"`
+			PeerLevel   *string         `json:"peer_level"`
+			Specialty   *string         `json:"specialty"`
+			Mentorship  *Mentorship     `json:"mentorship"`
+		} `json:"users"`
 	}
-	var responseBody map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return fmt.Errorf("failed to decode response body: %w", err)
+	if err := hasura.Request(requestBody, &responseData); err != nil {
+		return nil, fmt.Errorf("failed to get skill profiles: %w", err)
 	}
-	log.Printf("Hasura response: %+v", responseBody)
-	return nil
+	for _, u := range responseData.Users {
+		languages := make(map[string]bool, len(u.Language))
+		for _, language := range u.Language {
+			languages[language] = true
+		}
+		profile := SkillProfile{Proficiency: []LanguageSkill{}, PeerLevel: PeerLevelAny}
+		for _, skill := range u.Proficiency {
+			if languages[skill.Language] {
+				profile.Proficiency = append(profile.Proficiency, skill)
+			}
+		}
+		if u.PeerLevel != nil && *u.PeerLevel != "" {
+			profile.PeerLevel = *u.PeerLevel
+		}
+		if u.Specialty != nil {
+			profile.Specialty = *u.Specialty
+		}
+		if u.Mentorship != nil {
+			profile.Mentorship = *u.Mentorship
+		}
+		profiles[u.ID] = profile
+	}
+	return profiles, nil
+}
+func SkillMatchScore(seeker, candidate SkillProfile) float64 {
+	candidateSkills := make(map[string]LanguageSkill, len(candidate.Proficiency))
+	for _, skill := range candidate.Proficiency {
+		candidateSkills[skill.Language] = skill
+	}
+	score := 0.0
+	for _, own := range seeker.Proficiency {
+		other, ok := candidateSkills[own.Language]
+		if !ok {
+			continue
+		}
+		ownRank, otherRank := LevelRank(own.Level), LevelRank(other.Level)
+		switch seeker.PeerLevel {
+		case PeerLevelSame:
+			gap := ownRank - otherRank
+			if gap < 0 {
+				gap = -gap
+			}
+			score += 1 - float64(gap)/float64(len(ProficiencyLevels)-1)
+		case PeerLevelExperienced:
+			if otherRank > ownRank {
+				score += 1
+			} else if otherRank == ownRank && other.Years > own.Years {
+				score += 0.5
+			}
+		}
+	}
+	return score
+}
+func MentorMatchScore(mentee, mentor SkillProfile) int64 {
+	menteeRanks := make(map[string]int, len(mentee.Proficiency))
+	for _, skill := range mentee.Proficiency {
+		menteeRanks[skill.Language] = LevelRank(skill.Level)
+	}
+	mentorRanks := make(map[string]int, len(mentor.Proficiency))
+	for _, skill := range mentor.Proficiency {
+		mentorRanks[skill.Language] = LevelRank(skill.Level)
+	}
+	offered := make(map[string]bool, len(mentor.Mentorship.Languages)+len(mentor.Mentorship.Specialties))
+	for _, language := range mentor.Mentorship.Languages {
+		offered[language] = true
+	}
+	score := int64(0)
+	for _, language := range mentee.Mentorship.Languages {
+		if offered[language] && mentorRanks[language] > menteeRanks[language] {
+			score += int64(mentorRanks[language] - menteeRanks[language])
+		}
+	}
+	for _, specialty := range mentee.Mentorship.Specialties {
+		for _, offeredSpecialty := range mentor.Mentorship.Specialties {
+			if specialty == offeredSpecialty {
+				score++
+			}
+		}
+	}
+	return score
 }
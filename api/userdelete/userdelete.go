@@ -1,6 +1,7 @@
 package userdelete
 
 import (
+	"api/auditlog"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -59,6 +60,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error deleting user from Hasura: %s", err)
 		return
 	}
+	auditlog.Record(r, auditlog.ActorClerkWebhook, "user.deleted", userID, nil)
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]string{"status": "success"}
@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"api/auditlog"
+	"api/invites"
+	"api/savedsearches"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -57,6 +61,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Raw webhook payload: %s", string(body))
 	var rawPayload struct {
+		Type string `json:"type"`
 		Data struct {
 			ID               string            `json:"id"`
 			FirstName        string            `json:"first_name"`
@@ -64,6 +69,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			EmailAddresses   []EmailAddress    `json:"email_addresses"`
 			ExternalAccounts []ExternalAccount `json:"external_accounts"`
 			ImageURL         string            `json:"image_url"`
+			UnsafeMetadata   struct {
+				Invite string `json:"invite"`
+			} `json:"unsafe_metadata"`
 		} `json:"data"`
 	}
 
@@ -87,6 +95,31 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error inserting user into Hasura: %s", err)
 		return
 	}
+	emails := []string{}
+	for _, email := range user.EmailAddresses {
+		emails = append(emails, email.EmailAddress)
+	}
+	eventType := rawPayload.Type
+	if eventType == "" {
+		eventType = "user.updated"
+	}
+	auditlog.Record(r, auditlog.ActorClerkWebhook, eventType, user.ID, map[string]interface{}{"emails": emails})
+	if err := savedsearches.EvaluateProfile(user.ID); err != nil {
+		log.Printf("Error evaluating saved searches: %s", err)
+	}
+	if rawPayload.Type == "user.created" && rawPayload.Data.UnsafeMetadata.Invite != "" {
+		inviterID, err := invites.RedeemInvite(rawPayload.Data.UnsafeMetadata.Invite, user.ID)
+		if errors.Is(err, invites.ErrInvalidInvite) || errors.Is(err, invites.ErrInviteExpired) || errors.Is(err, invites.ErrInviteRevoked) || errors.Is(err, invites.ErrInviteRedeemed) || errors.Is(err, invites.ErrInviteNotFound) {
+			log.Printf("Ignoring invite for user %s: %s", user.ID, err)
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to redeem invite: %s", err), http.StatusInternalServerError)
+			log.Printf("Error redeeming invite for user %s: %s", user.ID, err)
+			return
+		} else {
+			auditlog.Record(r, user.ID, "friend.invite", inviterID, map[string]interface{}{"status": "accepted"})
+			log.Printf("User %s redeemed invite from %s", user.ID, inviterID)
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")